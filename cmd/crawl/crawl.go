@@ -1,40 +1,114 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"github.com/launchtime/scrapemonster/cmd"
+	"github.com/launchtime/scrapemonster/config"
 	"github.com/launchtime/scrapemonster/crawler"
 	"github.com/launchtime/scrapemonster/scrape"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 var (
-	scraper   scrape.Scraper
+	cfg       *config.Config
 	db        *scrape.DB
+	writer    *scrape.Writer
+	failures  int64 // rows the writer could not store
 	printChan = make(chan []byte)
+	archive   *crawler.Archive
+	warc      *crawler.WARCWriter
+	diags     *diagLog
 )
 
-// Command-line flags.
+// Command-line flags. They override the settings file and environment (see
+// package config); their defaults are the settings' defaults.
 var (
+	defaults    = config.Default()
+	batchSize   = flag.Int("batch", defaults.Database.BatchSize, "max rows per database transaction (with -db)")
+	burst       = flag.Int("burst", defaults.Crawl.Burst, "max back-to-back requests per host")
+	diagPath    = flag.String("diaglog", "", "write per-deal parse diagnostics to this file as JSON")
+	flushEvery  = flag.Duration("flush", defaults.Database.FlushInterval, "max time a row waits to be stored (with -db)")
+	frontierDir = flag.String("frontier", "", "keep <site>.frontier files in this directory, to be able to -resume")
 	getOptions  = flag.Bool("o", true, "get deal options")
-	maxDepth    = flag.Int("d", 10, "max crawl depth")
-	maxParallel = flag.Int("p", 10, "max simultaneous HTTP requests")
+	keepHistory = flag.Bool("history", false, "also keep every observation in the intraday history (with -db)")
+	maxDepth    = newPerSiteInt(defaults.Crawl.Depth)
+	maxParallel = newPerSiteInt(defaults.Crawl.Parallel)
+	minDelay    = flag.Duration("delay", defaults.Crawl.Delay, "min delay between requests per host")
 	quiet       = flag.Bool("q", false, "do not write JSON to stdout")
-	sitename    = flag.String("s", "", "site to crawl")
-	startURL    = flag.String("url", "", "override default start url")
+	obeyRobots  = flag.Bool("robots", true, "obey robots.txt")
+	resume      = flag.Bool("resume", false, "resume the crawls recorded in the frontier files")
+	rateLimit   = flag.Float64("r", defaults.Crawl.RateLimit, "max requests per second per host (0 = unlimited)")
+	recordDir   = flag.String("record", "", "record all HTTP traffic in this archive directory")
+	replayDir   = flag.String("replay", "", "replay HTTP traffic from this archive directory")
+	sitename    = flag.String("s", "", "sites to crawl: "+cmd.SitesUsage())
+	startURL    = flag.String("url", "", "override default start url (single site only)")
 	storeInDB   = flag.Bool("db", false, "store results in DB")
-	timeout     = flag.Uint("t", 5, "HTTP timeout (seconds)")
+	timeout     = flag.Uint("t", uint(defaults.Crawl.Timeout/time.Second), "HTTP timeout (seconds)")
 	verbose     = flag.Bool("v", false, "verbose output")
+	warcDir     = flag.String("warc", "", "save raw pages as WARC files in this directory")
+	warcSize    = flag.Int64("warcsize", 1024, "max size of each WARC file (MB)")
 )
 
+func init() {
+	flag.Var(maxDepth, "d", "max crawl depth (N or site=N, comma-separated)")
+	flag.Var(maxParallel, "p", "max simultaneous HTTP requests (N or site=N, comma-separated)")
+}
+
+// dealRef identifies a deal, the scraper that found it and the page it was
+// found on.
+type dealRef struct {
+	scraper scrape.Scraper
+	id      scrape.DealID
+	page    *crawler.Result
+}
+
+// dealOptions holds the options of the deal found on a page. The page is nil
+// if the options may be incomplete.
+type dealOptions struct {
+	page    *crawler.Result
+	options []*scrape.Option
+}
+
 type (
-	dealChannel   chan scrape.DealID
-	optionChannel chan []*scrape.Option
+	dealChannel   chan dealRef
+	optionChannel chan dealOptions
 )
 
+// crawlStats counts what the pipeline has processed for one site. Each field
+// is written by a single goroutine and read only after that goroutine has
+// finished.
+type crawlStats struct {
+	pages    int           // written by the site's consumeCrawlerResults
+	deals    int           // written by the site's consumeCrawlerResults
+	problems problemCounts // written by the site's consumeCrawlerResults
+	options  int           // written by consumeOptions
+}
+
+// site holds everything needed to crawl one site.
+type site struct {
+	scraper    scrape.Scraper
+	crawler    *crawler.Crawler
+	optGetter  *crawler.Getter // for the site's deal options
+	frontier   crawler.Frontier
+	resultChan chan *crawler.Result
+	stats      crawlStats
+	err        error // why the crawl failed, if it did
+}
+
+// Sites being crawled, keyed by name.
+var sites = make(map[string]*site)
+
 // chatter writes to the log iff the verbose command-line flag was given.
 func chatter(format string, v ...interface{}) {
 	if *verbose {
@@ -54,15 +128,84 @@ func printer(doneChan chan int) {
 	}
 }
 
-func consumeCrawlerResults(resultChan chan *crawler.Result, dealChan dealChannel) {
-	for r := range resultChan {
-		deal, err := scraper.ParseDeal(r.URL, r.Body)
+// newGetter returns a Getter configured with a site's settings and the
+// command-line flags.
+func newGetter(sc *config.Site) *crawler.Getter {
+	var g *crawler.Getter
+	switch {
+	case *replayDir != "":
+		g = crawler.NewReplayGetter(archive)
+	case *recordDir != "":
+		g = crawler.NewRecordingGetter(archive)
+	default:
+		g = crawler.NewGetter()
+	}
+	cmd.ConfigureGetter(g, sc)
+	g.Verbose = *verbose
+	if warc != nil {
+		g.WriteWARC(warc)
+	}
+	return g
+}
+
+// Returns a site's rate limit.
+func rateLimitOf(sc *config.Site) crawler.RateLimit {
+	return crawler.RateLimit{
+		PerSecond: sc.RateLimit,
+		Burst:     sc.Burst,
+		MinDelay:  sc.Delay,
+	}
+}
+
+// Returns the URL to start crawling a site at: the -url flag, the site's
+// setting, or the scraper's default, in that order.
+func startURLOf(scraper scrape.Scraper) string {
+	if *startURL != "" {
+		return *startURL
+	}
+	if u := cfg.Site(scraper.Name()).StartURL; u != "" {
+		return u
+	}
+	return scraper.DefaultStartURL()
+}
+
+// pageDone marks a page done in its site's frontier once everything found on
+// it has been stored, so that an interrupted crawl never loses deals that a
+// resumed one would not fetch again.
+func pageDone(page *crawler.Result) {
+	done := func() {
+		if err := page.Done(); err != nil {
+			log.Printf("frontier: %s", err)
+		}
+	}
+	if writer != nil {
+		writer.AfterStored(done)
+	} else {
+		done()
+	}
+}
+
+// consumeCrawlerResults parses the pages found by one site's crawler and
+// sends the deals down the pipeline.
+func consumeCrawlerResults(s *site, dealChan dealChannel, doneChan chan int) {
+	defer func() { doneChan <- 1 }()
+	for r := range s.resultChan {
+		s.stats.pages++
+		deal, err := s.scraper.ParseDeal(r.URL, r.Body)
 		if err != nil {
 			log.Print(err)
 		}
 		if deal == nil {
+			pageDone(r)
 			continue
 		}
+		s.stats.deals++
+		if len(deal.Diagnostics) > 0 {
+			s.stats.problems.add(deal.Diagnostics)
+			if diags != nil {
+				diags.write(r.URL.String(), deal)
+			}
+		}
 		// Optionally print the deal as JSON.
 		if !*quiet {
 			data, err := json.Marshal(deal)
@@ -72,32 +215,42 @@ func consumeCrawlerResults(resultChan chan *crawler.Result, dealChan dealChannel
 			printChan <- data
 		}
 		// Optionally store the deal in the database.
-		if *storeInDB {
-			err := db.StoreDeal(deal)
-			if err != nil {
-				log.Fatal(err)
-			}
+		if writer != nil {
+			writer.StoreDeal(deal)
 		}
 		// Send the deal ID down the pipeline.
-		dealChan <- deal.DealID
+		dealChan <- dealRef{s.scraper, deal.DealID, r}
 	}
-	close(dealChan)
 }
 
-func optionGetter(dealChan dealChannel, g *crawler.Getter,
+func optionGetter(ctx context.Context, dealChan dealChannel,
 	optionChan optionChannel, doneChan chan int) {
 	defer func() { doneChan <- 1 }()
-	for dealID := range dealChan {
+	for ref := range dealChan {
+		// Keep draining dealChan after an abort so its senders can finish.
+		// Their pages stay pending.
+		if ctx.Err() != nil {
+			continue
+		}
+		o := dealOptions{page: ref.page}
 		if *getOptions {
-			optionChan <- scraper.GetDealOptions(g, dealID)
+			g := sites[ref.scraper.Name()].optGetter
+			o.options = ref.scraper.GetDealOptions(ctx, g, ref.id)
 		}
+		if ctx.Err() != nil {
+			o.page = nil
+		}
+		optionChan <- o
 	}
 }
 
 func consumeOptions(optionChan optionChannel, doneChan chan int) {
 	defer func() { doneChan <- 1 }()
-	for options := range optionChan {
-		for _, option := range options {
+	for o := range optionChan {
+		for _, option := range o.options {
+			if s := sites[option.SiteName]; s != nil {
+				s.stats.options++
+			}
 			// Optionally print the option as JSON.
 			if !*quiet {
 				data, err := json.Marshal(option)
@@ -107,19 +260,72 @@ func consumeOptions(optionChan optionChannel, doneChan chan int) {
 				printChan <- data
 			}
 			// Optionally store the option in the database.
-			if *storeInDB {
-				err := db.StoreOption(option)
-				if err != nil {
-					log.Fatal(err)
-				}
+			if writer != nil {
+				writer.StoreOption(option)
 			}
 		}
+		if o.page != nil {
+			pageDone(o.page)
+		}
 	}
 }
 
+// trapSignals calls stop on the first SIGINT or SIGTERM and abort on the
+// second.
+func trapSignals(stop, abort context.CancelFunc) {
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigChan
+	log.Printf("%s: finishing in-flight deals (repeat to abort)", sig)
+	stop()
+	sig = <-sigChan
+	log.Printf("%s: aborting", sig)
+	abort()
+}
+
+// newSite sets up a crawler for the given scraper. The crawler throttles its
+// own fetches; the option getter needs to be throttled explicitly.
+func newSite(scraper scrape.Scraper, throttle *crawler.Throttle,
+	robots *crawler.RobotsChecker) *site {
+	name := scraper.Name()
+	sc := cfg.Site(name)
+	s := &site{scraper: scraper, resultChan: make(chan *crawler.Result)}
+	s.stats.problems = make(problemCounts)
+	s.optGetter = newGetter(sc)
+	s.optGetter.Throttle = throttle
+	s.optGetter.Robots = robots
+
+	// Persist the crawl frontier so that an interrupted crawl can be resumed.
+	if *frontierDir != "" {
+		path := filepath.Join(*frontierDir, name+".frontier")
+		chatter("opening frontier file: %s", path)
+		f, err := crawler.OpenFileFrontier(path, !*resume)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.frontier = f
+	} else if *resume {
+		log.Fatal("-resume needs the -frontier directory of the crawl to resume")
+	}
+
+	c := crawler.New(crawler.SimpleFetcher{
+		Getter:       newGetter(sc),
+		URLExtractor: scraper,
+	})
+	c.MaxDepth = sc.Depth
+	c.MaxParallel = sc.Parallel
+	c.Throttle = throttle
+	c.Robots = robots
+	c.Frontier = s.frontier
+	c.URLTransformer = scraper
+	c.OutputChan = s.resultChan
+	c.Verbose = *verbose
+	s.crawler = c
+	return s
+}
+
 func main() {
 	var (
-		resultChan = make(chan *crawler.Result)
 		dealChan   = make(dealChannel)
 		optionChan = make(optionChannel)
 		doneChan   = make(chan int)
@@ -127,64 +333,159 @@ func main() {
 	)
 
 	flag.Parse()
+	cfg = cmd.LoadConfig()
+	applyFlags(cfg)
+
+	started := time.Now()
+	scrapers := cmd.NewScrapers(*sitename)
+	if *startURL != "" && len(scrapers) != 1 {
+		log.Fatal("-url can only be used when crawling a single site")
+	}
 
-	scraper = cmd.NewScraper(*sitename)
+	// The first SIGINT or SIGTERM stops the crawl but lets deals already
+	// fetched run through the pipeline; a second one aborts everything.
+	abortCtx, abort := context.WithCancel(context.Background())
+	crawlCtx, stopCrawl := context.WithCancel(abortCtx)
+	defer abort()
+	go trapSignals(stopCrawl, abort)
 
 	// Connect to the database, if requested.
 	if *storeInDB {
-		uri := scrape.GetMySQLConnectionURI()
-		chatter("connecting to database: %s", uri)
-		db, err = scrape.OpenDatabase(uri)
+		chatter("connecting to database: %s", cfg.Database.URI)
+		db, err = cmd.OpenDatabase(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		db.History = *keepHistory
+		writer = db.NewWriter(cfg.Database.BatchSize, cfg.Database.FlushInterval)
+		writer.Failed = func(e *scrape.WriteError) {
+			log.Print(e)
+			atomic.AddInt64(&failures, 1)
+		}
+	}
+
+	// Open the HTTP archive to record to or replay from, if requested.
+	switch {
+	case *recordDir != "" && *replayDir != "":
+		log.Fatal("cannot record and replay at the same time")
+	case *replayDir != "":
+		chatter("replaying from archive: %s", *replayDir)
+		archive, err = crawler.OpenArchive(*replayDir)
+	case *recordDir != "":
+		chatter("recording to archive: %s", *recordDir)
+		archive, err = crawler.CreateArchive(*recordDir)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Save raw pages in WARC files, if requested.
+	if *warcDir != "" {
+		chatter("writing WARC files to: %s", *warcDir)
+		warc, err = crawler.NewWARCWriter(*warcDir, "crawl")
 		if err != nil {
 			log.Fatal(err)
 		}
+		warc.MaxSize = *warcSize << 20
 	}
 
-	getter := crawler.NewGetter()
-	getter.UserAgent = crawler.UserAgentStrings["MSIE8"]
-	getter.Timeout = time.Duration(*timeout) * time.Second
-	getter.Verbose = *verbose
+	// Log parse diagnostics, if requested.
+	if *diagPath != "" {
+		chatter("writing parse diagnostics to: %s", *diagPath)
+		diags, err = createDiagLog(*diagPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	crawler := crawler.New(crawler.SimpleFetcher{
-		Getter:       getter,
-		URLExtractor: scraper,
-	})
-	crawler.MaxDepth = *maxDepth
-	crawler.MaxParallel = *maxParallel
-	crawler.URLTransformer = scraper
-	crawler.OutputChan = resultChan
-	crawler.Verbose = *verbose
+	// Every request to a host, whether made by a crawler or by an
+	// optionGetter, draws from the same per-host budget. A site's own rate
+	// limit applies to the host of its start URL. There's no need to be
+	// polite to an archive.
+	var throttle *crawler.Throttle
+	if *replayDir == "" {
+		throttle = crawler.NewThrottle(rateLimitOf(&cfg.Crawl))
+		for _, scraper := range scrapers {
+			l := rateLimitOf(cfg.Site(scraper.Name()))
+			if u, err := url.Parse(startURLOf(scraper)); err == nil && l != throttle.Default {
+				throttle.SetLimit(u.Host, l)
+			}
+		}
+	}
+
+	// Check every URL against robots.txt, unless told otherwise.
+	var robots *crawler.RobotsChecker
+	if *obeyRobots {
+		g := newGetter(&cfg.Crawl)
+		g.Throttle = throttle
+		robots = crawler.NewRobotsChecker(g)
+		robots.UserAgent = g.UserAgent
+		robots.Throttle = throttle
+		robots.Verbose = *verbose
+		for _, scraper := range scrapers {
+			if a, ok := scraper.(scrape.RobotsAllowlister); ok {
+				for host, patterns := range a.RobotsAllowlist() {
+					robots.Allow(host, patterns...)
+				}
+			}
+		}
+	}
+
+	// Set up one crawler per site.
+	numOptionGetters := 0
+	for _, scraper := range scrapers {
+		s := newSite(scraper, throttle, robots)
+		sites[scraper.Name()] = s
+		numOptionGetters += s.crawler.MaxParallel
+	}
 
 	// Boot up the printer.
 	chatter("starting printer")
 	go printer(doneChan)
 
 	// Start a bunch of optionGetter goroutines.
-	chatter("starting %d optionGetter goroutines", *maxParallel)
-	for i := 0; i < *maxParallel; i++ {
-		go optionGetter(dealChan, getter, optionChan, doneChan)
+	chatter("starting %d optionGetter goroutines", numOptionGetters)
+	for i := 0; i < numOptionGetters; i++ {
+		go optionGetter(abortCtx, dealChan, optionChan, doneChan)
 	}
 
 	// Consume the output of the optionGetter goroutines.
 	chatter("starting consumeOptions")
 	go consumeOptions(optionChan, doneChan)
 
-	// Consume crawler results, process deals, forward to optionGetters.
-	chatter("starting consumeCrawlerResults")
-	go consumeCrawlerResults(resultChan, dealChan)
+	// Crawl every site concurrently. For each site, consume the crawler's
+	// results, process deals, and forward them to the optionGetters.
+	var wg sync.WaitGroup
+	for name, s := range sites {
+		chatter("starting consumeCrawlerResults for %s", name)
+		go consumeCrawlerResults(s, dealChan, doneChan)
 
-	// Start crawling.
-	if *startURL == "" {
-		*startURL = scraper.DefaultStartURL()
+		start := startURLOf(s.scraper)
+		chatter("starting crawl of %s at %s", name, start)
+		wg.Add(1)
+		go func(name string, s *site) {
+			defer wg.Done()
+			// A site that fails must not take the others down with it.
+			err := s.crawler.Go(crawlCtx, start)
+			if err != nil && err != context.Canceled {
+				log.Printf("%s: %s", name, err)
+				s.err = err
+			}
+		}(name, s)
 	}
-	chatter("starting crawl at %s", *startURL)
-	if err := crawler.Go(*startURL); err != nil {
-		log.Fatal(err)
+	wg.Wait()
+
+	// Wait for every consumeCrawlerResults to finish, then let the
+	// optionGetters know there are no more deals.
+	chatter("waiting for consumeCrawlerResults")
+	for range sites {
+		<-doneChan
 	}
+	close(dealChan)
 
 	// Wait for optionGetter goroutines to finish.
 	chatter("waiting for optionGetter goroutines")
-	for i := 0; i < *maxParallel; i++ {
+	for i := 0; i < numOptionGetters; i++ {
 		<-doneChan
 	}
 
@@ -197,4 +498,82 @@ func main() {
 	chatter("waiting for printer")
 	close(printChan)
 	<-doneChan
+
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+	if warc != nil {
+		if err := warc.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+	if diags != nil {
+		if err := diags.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+
+	// Make sure everything we stored has reached the database, and keep
+	// track of how well the deals of the days we crawled on were parsed (see
+	// cmd/healthcheck).
+	if db != nil {
+		chatter("flushing database writes")
+		writer.Close()
+		if n := atomic.LoadInt64(&failures); n > 0 {
+			log.Printf("failed to store %d deals and options", n)
+		}
+		for day := scrape.Day(started); !day.After(scrape.Day(time.Now())); day = day.AddDate(0, 0, 1) {
+			if err := db.UpdateFillRates(day); err != nil {
+				log.Print(err)
+			}
+		}
+		chatter("closing database")
+		if err := db.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+
+	// The frontiers are complete only once everything has been stored.
+	for _, s := range sites {
+		if s.frontier != nil {
+			if err := s.frontier.Close(); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+
+	// Report URLs we skipped because of robots.txt.
+	if robots != nil {
+		for host, n := range robots.Blocked() {
+			log.Printf("robots.txt blocked %d urls on %s", n, host)
+		}
+	}
+
+	status := "finished"
+	if crawlCtx.Err() != nil {
+		status = "interrupted"
+	}
+	var (
+		total  crawlStats
+		failed []string
+	)
+	for _, scraper := range scrapers {
+		if sites[scraper.Name()].err != nil {
+			failed = append(failed, scraper.Name())
+		}
+		st := sites[scraper.Name()].stats
+		log.Printf("%s: %d pages, %d deals, %d options",
+			scraper.Name(), st.pages, st.deals, st.options)
+		st.problems.report(scraper.Name(), st.deals)
+		total.pages += st.pages
+		total.deals += st.deals
+		total.options += st.options
+	}
+	log.Printf("crawl %s after %s: %d pages, %d deals, %d options",
+		status, time.Since(started), total.pages, total.deals, total.options)
+	if len(failed) > 0 {
+		log.Fatalf("crawl of %s failed", strings.Join(failed, ", "))
+	}
 }
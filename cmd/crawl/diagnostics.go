@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/launchtime/scrapemonster/scrape"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// problemKey identifies one kind of parse problem with one field.
+type problemKey struct {
+	field    string
+	kind     string
+	selector string
+}
+
+// problemCounts counts the deals of one site that had each kind of problem.
+type problemCounts map[problemKey]int
+
+// Counts the problems of one deal, each kind at most once.
+func (pc problemCounts) add(diag scrape.Diagnostics) {
+	seen := make(map[problemKey]bool)
+	for _, d := range diag {
+		k := problemKey{d.Field, d.Kind, d.Selector}
+		if !seen[k] {
+			seen[k] = true
+			pc[k]++
+		}
+	}
+}
+
+// Logs the problems of one site, sorted by field, with the share of the
+// site's deals they affected.
+func (pc problemCounts) report(site string, deals int) {
+	keys := make([]problemKey, 0, len(pc))
+	for k := range pc {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].field != keys[j].field {
+			return keys[i].field < keys[j].field
+		}
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].selector < keys[j].selector
+	})
+	for _, k := range keys {
+		n := pc[k]
+		sel := ""
+		if k.selector != "" {
+			sel = " (" + k.selector + ")"
+		}
+		log.Printf("%s: %s: %s%s in %d of %d deals (%.1f%%)",
+			site, k.field, k.kind, sel, n, deals, 100*float64(n)/float64(deals))
+	}
+}
+
+// diagLog writes the diagnostics of every deal that had any, one JSON object
+// per line. It is safe for concurrent use.
+type diagLog struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+type diagRecord struct {
+	Site        string             `json:"site"`
+	DealID      scrape.DealID      `json:"deal_id"`
+	URL         string             `json:"url"`
+	Diagnostics scrape.Diagnostics `json:"diagnostics"`
+}
+
+func createDiagLog(path string) (l *diagLog, err error) {
+	var f *os.File
+	if f, err = os.Create(path); err != nil {
+		return
+	}
+	l = &diagLog{w: f, enc: json.NewEncoder(f)}
+	return
+}
+
+func (l *diagLog) write(url string, d *scrape.Deal) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// The diagnostics are a side log: losing some is no reason to stop
+	// crawling.
+	err := l.enc.Encode(&diagRecord{d.SiteName, d.DealID, url, d.Diagnostics})
+	if err != nil {
+		log.Printf("diagnostics: %s", err)
+	}
+}
+
+func (l *diagLog) Close() error {
+	return l.w.Close()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/launchtime/scrapemonster/config"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// perSiteInt is a flag.Value holding an integer setting that can be
+// overridden per site. Its value is a comma-separated list of entries, each
+// either N (the default for all sites) or site=N. The flag may be repeated.
+type perSiteInt struct {
+	def    int
+	defSet bool // whether the flag set def
+	sites  map[string]int
+}
+
+func newPerSiteInt(def int) *perSiteInt {
+	return &perSiteInt{def: def, sites: make(map[string]int)}
+}
+
+// apply sets the crawl setting with the given key to the values the flag
+// was given: the default for every site, then the values for single sites.
+func (p *perSiteInt) apply(c *config.Config, key string) (err error) {
+	if p.defSet {
+		if err = c.Set("crawl."+key, strconv.Itoa(p.def)); err != nil {
+			return
+		}
+	}
+	for site, n := range p.sites {
+		if err = c.Set("site."+site+"."+key, strconv.Itoa(n)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Settings set by flags, by flag name. The flags must print their values in
+// the format config.Set parses.
+var flagSettings = map[string]string{
+	"batch": "database.batch_size",
+	"burst": "crawl.burst",
+	"delay": "crawl.delay",
+	"flush": "database.flush_interval",
+	"r":     "crawl.rate_limit",
+}
+
+// applyFlags overrides the settings with the flags given on the command
+// line.
+func applyFlags(c *config.Config) {
+	flag.Visit(func(f *flag.Flag) {
+		var err error
+		switch f.Name {
+		case "d":
+			err = maxDepth.apply(c, "depth")
+		case "p":
+			err = maxParallel.apply(c, "parallel")
+		case "t":
+			err = c.Set("crawl.timeout", f.Value.String()+"s")
+		default:
+			if key, ok := flagSettings[f.Name]; ok {
+				err = c.Set(key, f.Value.String())
+			}
+		}
+		if err != nil {
+			log.Fatalf("-%s: %s", f.Name, err)
+		}
+	})
+}
+
+func (p *perSiteInt) String() string {
+	if p == nil {
+		return ""
+	}
+	var a []string
+	for site, n := range p.sites {
+		a = append(a, fmt.Sprintf("%s=%d", site, n))
+	}
+	sort.Strings(a)
+	return strings.Join(append([]string{strconv.Itoa(p.def)}, a...), ",")
+}
+
+func (p *perSiteInt) Set(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		site, num := "", entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			site, num = entry[:i], entry[i+1:]
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(num))
+		if err != nil {
+			return err
+		}
+		if site == "" {
+			p.def = n
+			p.defSet = true
+		} else {
+			p.sites[strings.TrimSpace(site)] = n
+		}
+	}
+	return nil
+}
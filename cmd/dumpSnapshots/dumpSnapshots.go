@@ -5,6 +5,7 @@ import (
 	"encoding/csv"
 	"flag"
 	"fmt"
+	"github.com/launchtime/scrapemonster/cmd"
 	"github.com/launchtime/scrapemonster/scrape"
 	"io"
 	"log"
@@ -17,6 +18,7 @@ import (
 var (
 	dayFlag        = flag.String("day", "", "day to dump in yyyy-mm-dd format (default: today)")
 	dumpDir        = flag.String("dir", "/tmp", "destination directory")
+	dumpHistory    = flag.Bool("history", false, "also dump the day's intraday history")
 	shouldCompress = flag.Bool("compress", false, "gzip compress output files")
 )
 
@@ -24,11 +26,11 @@ const YYYY_MM_DD = "2006-01-02"
 
 func getDay() time.Time {
 	if *dayFlag != "" {
-		d, err := time.Parse(YYYY_MM_DD, *dayFlag)
+		d, err := scrape.ParseDay(*dayFlag)
 		must(err)
 		return d
 	}
-	return time.Now()
+	return scrape.Day(time.Now())
 }
 
 func formatNullable(v interface{}) string {
@@ -68,7 +70,7 @@ func must(e error) {
 	}
 }
 
-func writeDealsCsv(db *scrape.DB, day time.Time) {
+func writeDealsCsv(db scrape.Store, day time.Time) {
 	log.Printf("retrieving deals")
 	rows, err := db.GetDealDailySnapshots(day)
 	must(err)
@@ -107,7 +109,7 @@ func writeDealsCsv(db *scrape.DB, day time.Time) {
 	writeCsv("deals", day, records)
 }
 
-func writeOptionsCsv(db *scrape.DB, day time.Time) {
+func writeOptionsCsv(db scrape.Store, day time.Time) {
 	log.Printf("retrieving options")
 	rows, err := db.GetOptionDailySnapshots(day)
 	must(err)
@@ -138,6 +140,64 @@ func writeOptionsCsv(db *scrape.DB, day time.Time) {
 	writeCsv("options", day, records)
 }
 
+func writeDealHistoryCsv(db scrape.Store, day time.Time) {
+	log.Printf("retrieving deal history")
+	rows, err := db.GetDealSnapshots(scrape.DayTimes(day))
+	must(err)
+
+	records := make([][]string, 0, len(rows)+1)
+	records = append(records, []string{
+		"Site",
+		"DealID",
+		"Captured",
+		"OriginalPrice",
+		"DiscountPrice",
+		"NumSold",
+		"IsExpired",
+	})
+	for _, r := range rows {
+		records = append(records, []string{
+			r.Site,
+			strconv.FormatInt(r.DealID, 10),
+			r.Captured.In(scrape.DayZone).Format(time.RFC3339),
+			formatNullable(r.OriginalPrice),
+			formatNullable(r.DiscountPrice),
+			formatNullable(r.NumSold),
+			strconv.FormatBool(r.IsExpired),
+		})
+	}
+	writeCsv("deal_history", day, records)
+}
+
+func writeOptionHistoryCsv(db scrape.Store, day time.Time) {
+	log.Printf("retrieving option history")
+	rows, err := db.GetOptionSnapshots(scrape.DayTimes(day))
+	must(err)
+
+	records := make([][]string, 0, len(rows)+1)
+	records = append(records, []string{
+		"Site",
+		"DealID",
+		"OptionID",
+		"Captured",
+		"Price",
+		"NumAvailable",
+		"NumSold",
+	})
+	for _, r := range rows {
+		records = append(records, []string{
+			r.Site,
+			strconv.FormatInt(r.DealID, 10),
+			strconv.FormatInt(r.OptionID, 10),
+			r.Captured.In(scrape.DayZone).Format(time.RFC3339),
+			formatNullable(r.Price),
+			formatNullable(r.NumAvailable),
+			formatNullable(r.NumSold),
+		})
+	}
+	writeCsv("option_history", day, records)
+}
+
 func writeCsv(what string, day time.Time, records [][]string) {
 	filename, fileWriter := openCsvFile(what, day)
 	log.Printf("writing %s to %s", what, filename)
@@ -149,15 +209,25 @@ func writeCsv(what string, day time.Time, records [][]string) {
 
 func main() {
 	flag.Parse()
+	cfg := cmd.LoadConfig()
+	if !cmd.FlagSet("dir") {
+		*dumpDir = cfg.Dump.Dir
+	}
+	if !cmd.FlagSet("compress") {
+		*shouldCompress = cfg.Dump.Compress
+	}
 
 	day := getDay()
 	log.Printf("dumping snapshots for %s", day.Format(YYYY_MM_DD))
 
-	uri := scrape.GetMySQLConnectionURI()
-	log.Printf("connecting to database: %s", uri)
-	db, err := scrape.OpenDatabase(uri)
+	log.Printf("connecting to database: %s", cfg.Database.URI)
+	db, err := cmd.OpenDatabase(cfg)
 	must(err)
 
 	writeDealsCsv(db, day)
 	writeOptionsCsv(db, day)
+	if *dumpHistory {
+		writeDealHistoryCsv(db, day)
+		writeOptionHistoryCsv(db, day)
+	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,12 +15,12 @@ import (
 var (
 	dealIDArg  = flag.Int("d", 0, "deal ID")
 	getOptions = flag.Bool("o", true, "get deal options")
-	sitename   = flag.String("s", "", "site to crawl")
+	sitename   = flag.String("s", "", "site of the deal: "+cmd.SiteUsage())
 )
 
 func getDeal(s scrape.Scraper, g *crawler.Getter, id scrape.DealID) *scrape.Deal {
 	url := s.DealURL(id)
-	data, err := g.GetBody(url.String())
+	data, err := g.GetBody(context.Background(), url.String())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -39,6 +40,7 @@ type info struct {
 
 func main() {
 	flag.Parse()
+	cfg := cmd.LoadConfig()
 
 	if *dealIDArg == 0 {
 		fmt.Println("Usage error: Deal ID (-d flag) is required.")
@@ -49,11 +51,12 @@ func main() {
 	scraper := cmd.NewScraper(*sitename)
 	dealID := scrape.DealID(*dealIDArg)
 	getter := crawler.NewGetter()
+	cmd.ConfigureGetter(getter, cfg.Site(scraper.Name()))
 	getter.Verbose = true
 
 	info := info{Deal: getDeal(scraper, getter, dealID)}
 	if *getOptions {
-		info.Options = scraper.GetDealOptions(getter, dealID)
+		info.Options = scraper.GetDealOptions(context.Background(), getter, dealID)
 	}
 
 	data, err := json.MarshalIndent(info, "", "    ")
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/launchtime/scrapemonster/cmd"
+	"github.com/launchtime/scrapemonster/scrape"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Command-line flags.
+var (
+	dayFlag  = flag.String("day", "", "day to check in yyyy-mm-dd format (default: today)")
+	maxDrop  = flag.Float64("drop", 0.25, "max drop in a fill rate relative to the trailing average (0.25 = 25%)")
+	minDeals = flag.Int("min", 20, "min deals per site and day for a fill rate to count")
+	sitename = flag.String("s", "all", "sites to check: "+cmd.SitesUsage())
+	trailing = flag.Int("n", 7, "number of days in the trailing average")
+	update   = flag.Bool("u", true, "recompute the fill rates of the checked day first")
+	verbose  = flag.Bool("v", false, "verbose output")
+)
+
+const YYYY_MM_DD = "2006-01-02"
+
+func must(e error) {
+	if e != nil {
+		log.Fatal(e)
+	}
+}
+
+// chatter writes to the log iff the verbose command-line flag was given.
+func chatter(format string, v ...interface{}) {
+	if *verbose {
+		log.Printf(format, v...)
+	}
+}
+
+func getDay() time.Time {
+	if *dayFlag != "" {
+		d, err := scrape.ParseDay(*dayFlag)
+		must(err)
+		return d
+	}
+	return scrape.Day(time.Now())
+}
+
+// Fill rates of one site and field, keyed by day.
+type history map[string]*scrape.FillRate
+
+type siteField struct {
+	site  string
+	field string
+}
+
+// Returns the trailing average of the fill rates in h on the days before
+// day, skipping days with too few deals, and the number of days averaged.
+func (h history) trailingAverage(day time.Time) (avg float64, days int) {
+	for i := 1; i <= *trailing; i++ {
+		r := h[day.AddDate(0, 0, -i).Format(YYYY_MM_DD)]
+		if r == nil || r.Deals < *minDeals {
+			continue
+		}
+		avg += r.Rate()
+		days++
+	}
+	if days > 0 {
+		avg /= float64(days)
+	}
+	return
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Exits with status 1 if a deal field's fill rate dropped.\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	cfg := cmd.LoadConfig()
+
+	day := getDay()
+	first := day.AddDate(0, 0, -*trailing)
+	checked := make(map[string]bool)
+	for _, s := range cmd.NewScrapers(*sitename) {
+		checked[s.Name()] = true
+	}
+
+	chatter("connecting to database: %s", cfg.Database.URI)
+	db, err := cmd.OpenDatabase(cfg)
+	must(err)
+
+	if *update {
+		chatter("updating fill rates for %s", day.Format(YYYY_MM_DD))
+		must(db.UpdateFillRates(day))
+	}
+	rates, err := db.GetFillRates(first, day)
+	must(err)
+	must(db.Close())
+
+	histories := make(map[siteField]history)
+	for _, r := range rates {
+		if !checked[r.Site] {
+			continue
+		}
+		k := siteField{r.Site, r.Field}
+		if histories[k] == nil {
+			histories[k] = make(history)
+		}
+		histories[k][r.Day.Format(YYYY_MM_DD)] = r
+	}
+	keys := make([]siteField, 0, len(histories))
+	for k := range histories {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].site != keys[j].site {
+			return keys[i].site < keys[j].site
+		}
+		return keys[i].field < keys[j].field
+	})
+
+	var regressions []string
+	reported := make(map[string]bool)
+	for _, k := range keys {
+		h := histories[k]
+		avg, days := h.trailingAverage(day)
+		if days == 0 {
+			chatter("%s %s: no history", k.site, k.field)
+			continue
+		}
+		today := h[day.Format(YYYY_MM_DD)]
+		switch {
+		case today == nil || today.Deals == 0:
+			// A site that stopped yielding deals at all is reported once,
+			// not once per field.
+			if !reported[k.site] {
+				regressions = append(regressions, fmt.Sprintf(
+					"%s: no deals on %s", k.site, day.Format(YYYY_MM_DD)))
+				reported[k.site] = true
+			}
+		case today.Deals < *minDeals:
+			chatter("%s %s: only %d deals", k.site, k.field, today.Deals)
+		case today.Rate() < avg*(1-*maxDrop):
+			regressions = append(regressions, fmt.Sprintf(
+				"%s: %s filled in %.1f%% of %d deals on %s, trailing %d-day average %.1f%%",
+				k.site, k.field, 100*today.Rate(), today.Deals,
+				day.Format(YYYY_MM_DD), days, 100*avg))
+		default:
+			chatter("%s %s: %.1f%% (average %.1f%%)",
+				k.site, k.field, 100*today.Rate(), 100*avg)
+		}
+	}
+
+	if len(regressions) > 0 {
+		fmt.Println(strings.Join(regressions, "\n"))
+		os.Exit(1)
+	}
+	chatter("all fill rates ok")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/launchtime/scrapemonster/cmd"
+	"github.com/launchtime/scrapemonster/crawler"
+	"github.com/launchtime/scrapemonster/scrape"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Command-line flags.
+var (
+	archiveDir = flag.String("archive", "", "read pages from this archive directory (see crawl -record)")
+	dryRun     = flag.Bool("n", false, "dry run: report changes without writing them")
+	history    = flag.Bool("history", false, "also rebuild the intraday history from every capture")
+	sitename   = flag.String("s", "all", "sites whose pages to reparse: "+cmd.SitesUsage())
+	verbose    = flag.Bool("v", false, "verbose output")
+)
+
+const YYYY_MM_DD = "2006-01-02"
+
+var scrapers []scrape.Scraper
+
+// A deal as parsed from the latest capture of its page on a given day. That
+// is the capture whose data the original crawl left in the database.
+type parsedDeal struct {
+	deal     *scrape.Deal
+	day      time.Time
+	captured time.Time
+}
+
+type dealDay struct {
+	site string
+	id   scrape.DealID
+	day  string
+}
+
+var deals = make(map[dealDay]*parsedDeal)
+
+// Every deal parsed, in the order the captures were read; kept only if the
+// history is being rebuilt.
+var observations []*parsedDeal
+
+func must(e error) {
+	if e != nil {
+		log.Fatal(e)
+	}
+}
+
+// chatter writes to the log iff the verbose command-line flag was given.
+func chatter(format string, v ...interface{}) {
+	if *verbose {
+		log.Printf(format, v...)
+	}
+}
+
+// parseCapture runs the current scrapers over a stored page and remembers the
+// resulting deal if it is the latest one seen for its day.
+func parseCapture(c *crawler.Capture) error {
+	for _, scraper := range scrapers {
+		deal, err := scraper.ParseDeal(c.URL, string(c.Body))
+		if err != nil {
+			log.Printf("%s: %s", c.URL, err)
+			continue
+		}
+		if deal == nil {
+			continue
+		}
+		day := scrape.Day(c.Time)
+		p := &parsedDeal{deal, day, c.Time}
+		k := dealDay{deal.SiteName, deal.DealID, day.Format(YYYY_MM_DD)}
+		if prev := deals[k]; prev == nil || !c.Time.Before(prev.captured) {
+			deals[k] = p
+		}
+		if *history {
+			observations = append(observations, p)
+		}
+	}
+	return nil
+}
+
+// Returns the WARC files named on the command line; directories are searched
+// for *.warc.gz and *.warc files.
+func warcFiles(args []string) (files []string) {
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		must(err)
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		for _, pattern := range []string{"*.warc.gz", "*.warc"} {
+			matches, err := filepath.Glob(filepath.Join(arg, pattern))
+			must(err)
+			files = append(files, matches...)
+		}
+	}
+	return
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [warc files or dirs...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	cfg := cmd.LoadConfig()
+
+	files := warcFiles(flag.Args())
+	if *archiveDir == "" && len(files) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	scrapers = cmd.NewScrapers(*sitename)
+
+	// Parse every stored page.
+	if *archiveDir != "" {
+		log.Printf("reading archive %s", *archiveDir)
+		archive, err := crawler.OpenArchive(*archiveDir)
+		must(err)
+		must(archive.Each(parseCapture))
+	}
+	for _, file := range files {
+		log.Printf("reading %s", file)
+		must(crawler.ReadWARC(file, parseCapture))
+	}
+	log.Printf("parsed %d deal snapshots", len(deals))
+
+	chatter("connecting to database: %s", cfg.Database.URI)
+	db, err := cmd.OpenDatabase(cfg)
+	must(err)
+	defer db.Close()
+
+	// Process snapshots in a stable order.
+	keys := make([]dealDay, 0, len(deals))
+	for k := range deals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].day != keys[j].day {
+			return keys[i].day < keys[j].day
+		}
+		if keys[i].site != keys[j].site {
+			return keys[i].site < keys[j].site
+		}
+		return keys[i].id < keys[j].id
+	})
+
+	var nnew, nchanged, nsame int
+	rewritten := make(map[string]time.Time)
+	for _, k := range keys {
+		p := deals[k]
+		snap, err := db.GetDealDailySnapshot(k.site, k.id, p.day)
+		must(err)
+		if snap == nil {
+			fmt.Printf("%s %d %s: new snapshot\n", k.site, k.id, k.day)
+			nnew++
+		} else if changes := snap.Diff(p.deal); len(changes) > 0 {
+			for _, c := range changes {
+				fmt.Printf("%s %d %s: %s: %q -> %q\n",
+					k.site, k.id, k.day, c.Field, c.Old, c.New)
+			}
+			nchanged++
+		} else {
+			nsame++
+			continue
+		}
+		if !*dryRun {
+			must(db.StoreDealOn(p.deal, p.day))
+			rewritten[k.day] = p.day
+		}
+	}
+
+	// Keep the fill rates of the rewritten days in line with their deals.
+	for name, day := range rewritten {
+		chatter("updating fill rates for %s", name)
+		must(db.UpdateFillRates(day))
+	}
+
+	// The history holds every observation, changed or not. Rewriting it is
+	// idempotent, since observations are keyed by their capture time.
+	if *history && !*dryRun {
+		for _, p := range observations {
+			must(db.AppendDeal(p.deal, p.captured))
+		}
+		log.Printf("rewrote %d history observations", len(observations))
+	}
+
+	verb := "rewrote"
+	if *dryRun {
+		verb = "would rewrite"
+	}
+	log.Printf("%s %d snapshots (%d new, %d changed); %d unchanged",
+		verb, nnew+nchanged, nnew, nchanged, nsame)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/launchtime/scrapemonster/cmd"
+	"github.com/launchtime/scrapemonster/scrape"
+	"log"
+	"os"
+)
+
+// Command-line flags.
+var (
+	toVersion = flag.Int("to", -1, "schema version to migrate to; -1 means the latest for up, and the one before the current for down")
+	verbose   = flag.Bool("v", false, "verbose output")
+)
+
+func must(e error) {
+	if e != nil {
+		log.Fatal(e)
+	}
+}
+
+// chatter writes to the log iff the verbose command-line flag was given.
+func chatter(format string, v ...interface{}) {
+	if *verbose {
+		log.Printf(format, v...)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] migrate up|down|status\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Migrates the schema of the configured database.\n")
+	flag.PrintDefaults()
+}
+
+func printStatus(db *scrape.DB) {
+	ss, err := db.MigrationStatus()
+	must(err)
+	for _, s := range ss {
+		state := "pending"
+		if s.Applied != nil {
+			state = "applied " + s.Applied.Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case s.Migration == nil:
+			state += " (unknown to this program)"
+		case s.Modified:
+			state += " (modified since)"
+		}
+		fmt.Printf("%04d  %-30s  %s\n", s.Version, s.Name, state)
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) != 2 || args[0] != "migrate" {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg := cmd.LoadConfig()
+	chatter("connecting to database: %s", cfg.Database.URI)
+	db, err := cmd.OpenDatabase(cfg)
+	must(err)
+	defer db.Close()
+
+	switch args[1] {
+	case "up":
+		ms, err := db.MigrateUp(*toVersion)
+		must(err)
+		for _, m := range ms {
+			log.Printf("applied %04d %s", m.Version, m.Name)
+		}
+		if len(ms) == 0 {
+			chatter("schema is up to date")
+		}
+	case "down":
+		to := *toVersion
+		if to < 0 {
+			v, err := db.SchemaVersion()
+			must(err)
+			to = v - 1
+		}
+		ms, err := db.MigrateDown(to)
+		must(err)
+		for _, m := range ms {
+			log.Printf("reverted %04d %s", m.Version, m.Name)
+		}
+	case "status":
+		printStatus(db)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
@@ -1,30 +1,117 @@
 package cmd
 
 import (
+	"flag"
+	"github.com/launchtime/scrapemonster/config"
+	"github.com/launchtime/scrapemonster/crawler"
 	"github.com/launchtime/scrapemonster/scrape"
-	"github.com/launchtime/scrapemonster/scrape/coupang"
-	"github.com/launchtime/scrapemonster/scrape/tmon"
-	"github.com/launchtime/scrapemonster/scrape/wmp"
+	_ "github.com/launchtime/scrapemonster/scrape/coupang"
+	_ "github.com/launchtime/scrapemonster/scrape/groupon"
+	_ "github.com/launchtime/scrapemonster/scrape/tmon"
+	_ "github.com/launchtime/scrapemonster/scrape/wmp"
 	"log"
 	"os"
+	"strings"
 )
 
-func GetMySQLConnectionURI() string {
-	if uri := os.Getenv("MYSQL_CONNECTION_URI"); uri != "" {
-		return uri
+var configPath = flag.String("config", "", "settings file (default: $SCRAPEMONSTER_CONFIG, if set)")
+
+// The directory whose site definitions were loaded, if any.
+var sitesDir string
+
+// LoadConfig returns the settings made by the defaults, the settings file
+// named by the -config flag or the SCRAPEMONSTER_CONFIG environment
+// variable, and the environment (see package config). Call it after parsing
+// the flags, and override the result with the flags the command was given.
+// Sites defined by JSON files (see scrape.SiteConfig) are loaded from the
+// sites_dir setting.
+func LoadConfig() *config.Config {
+	c := config.Default()
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("SCRAPEMONSTER_CONFIG")
+	}
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := c.ApplyEnv(os.Environ()); err != nil {
+		log.Fatal(err)
+	}
+	if c.SitesDir != "" && c.SitesDir != sitesDir {
+		if err := scrape.LoadSiteConfigs(c.SitesDir); err != nil {
+			log.Fatal(err)
+		}
+		sitesDir = c.SitesDir
+	}
+	return c
+}
+
+// FlagSet reports whether the named flag was given on the command line.
+func FlagSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+// OpenDatabase connects to the configured database and sets up its
+// connection pool.
+func OpenDatabase(c *config.Config) (db *scrape.DB, err error) {
+	if db, err = scrape.OpenDatabase(c.Database.URI); err != nil {
+		return
+	}
+	db.NoPrepare = c.Database.NoPrepare
+	db.ConfigurePool(scrape.PoolConfig{
+		MaxOpenConns:    c.Database.MaxOpenConns,
+		MaxIdleConns:    c.Database.MaxIdleConns,
+		ConnMaxLifetime: c.Database.ConnMaxLifetime,
+		ConnMaxIdleTime: c.Database.ConnMaxIdleTime,
+	})
+	return
+}
+
+// ConfigureGetter applies a site's user agent and timeout to a Getter.
+func ConfigureGetter(g *crawler.Getter, s *config.Site) {
+	g.UserAgent = s.UserAgent
+	if ua, ok := crawler.UserAgentStrings[s.UserAgent]; ok {
+		g.UserAgent = ua
 	}
-	return "coupang//"
+	g.Timeout = s.Timeout
+}
+
+// SiteUsage describes the valid values of a site flag, for use in its help
+// text.
+func SiteUsage() string {
+	return "one of " + strings.Join(scrape.Sites(), ", ")
+}
+
+// SitesUsage is like SiteUsage, for flags that accept several sites.
+func SitesUsage() string {
+	return "comma-separated list of " + strings.Join(scrape.Sites(), ", ") + `; or "all"`
 }
 
 func NewScraper(site string) scrape.Scraper {
-	switch site {
-	case "coupang":
-		return new(coupang.Scraper)
-	case "tmon":
-		return new(tmon.Scraper)
-	case "wmp":
-		return new(wmp.Scraper)
-	}
-	log.Fatalf(`could not create scraper: invalid site "%s"`, site)
+	if s, ok := scrape.Lookup(site); ok {
+		return s
+	}
+	log.Fatalf(`could not create scraper: invalid site "%s" (valid sites: %s)`,
+		site, strings.Join(scrape.Sites(), ", "))
 	return nil
 }
+
+// NewScrapers returns a scraper for each site in a comma-separated list, or
+// for every registered site if the list is "all".
+func NewScrapers(sites string) (scrapers []scrape.Scraper) {
+	names := strings.Split(sites, ",")
+	if sites == "all" {
+		names = scrape.Sites()
+	}
+	for _, name := range names {
+		scrapers = append(scrapers, NewScraper(strings.TrimSpace(name)))
+	}
+	return
+}
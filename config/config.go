@@ -0,0 +1,302 @@
+// Package config holds the settings shared by the scrapemonster commands.
+//
+// Settings come from four places. Each overrides the ones before it:
+//
+//  1. the defaults (see Default);
+//  2. a TOML file (see LoadFile, and example.toml for the format);
+//  3. environment variables named after the settings (see ApplyEnv);
+//  4. command-line flags.
+//
+// The crawl settings in the [crawl] section apply to every site, and can be
+// overridden for one site in a [site.<name>] section. A crawl setting from a
+// later source overrides the site sections of earlier ones: an environment
+// variable that sets the crawl depth sets it for every site.
+package config
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// A directory of JSON site definitions (see scrape.SiteConfig).
+	SitesDir string `toml:"sites_dir"`
+
+	Database Database `toml:"database"`
+	Dump     Dump     `toml:"dump"`
+
+	// The crawl settings of sites without a section of their own.
+	Crawl Site `toml:"crawl"`
+
+	// The crawl settings of the sites with a section, by name. Use Site to
+	// look up the settings of any site.
+	Sites map[string]*Site `toml:"-"`
+}
+
+type Database struct {
+	URI string `toml:"uri"` // see scrape.OpenDatabase
+
+	// Rows are stored in batches of up to BatchSize rows, at least every
+	// FlushInterval (see scrape.Writer).
+	BatchSize     int           `toml:"batch_size"`
+	FlushInterval time.Duration `toml:"flush_interval"`
+
+	// See scrape.PoolConfig; zero means database/sql's default.
+	MaxOpenConns    int           `toml:"max_open_conns"`
+	MaxIdleConns    int           `toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `toml:"conn_max_idle_time"`
+
+	// Don't prepare statements; see scrape.DB.
+	NoPrepare bool `toml:"no_prepare"`
+}
+
+// Dump holds the settings of dumpSnapshots.
+type Dump struct {
+	Dir      string `toml:"dir"`
+	Compress bool   `toml:"compress"`
+}
+
+// Site holds the crawl settings of a site.
+type Site struct {
+	StartURL  string        `toml:"start_url"` // empty for the scraper's default
+	Depth     int           `toml:"depth"`
+	Parallel  int           `toml:"parallel"`   // max simultaneous requests
+	RateLimit float64       `toml:"rate_limit"` // requests per second; 0 = unlimited
+	Burst     int           `toml:"burst"`
+	Delay     time.Duration `toml:"delay"` // min delay between requests
+	Timeout   time.Duration `toml:"timeout"`
+
+	// A User-Agent header, or the name of one in crawler.UserAgentStrings.
+	UserAgent string `toml:"user_agent"`
+}
+
+// Default returns the default settings.
+func Default() *Config {
+	return &Config{
+		Database: Database{
+			URI:           "scrapemonster//",
+			BatchSize:     100,
+			FlushInterval: 5 * time.Second,
+		},
+		Dump: Dump{Dir: "/tmp"},
+		Crawl: Site{
+			Depth:     10,
+			Parallel:  10,
+			RateLimit: 2,
+			Burst:     1,
+			Timeout:   5 * time.Second,
+			UserAgent: "MSIE8",
+		},
+		Sites: make(map[string]*Site),
+	}
+}
+
+// Site returns the crawl settings of the named site.
+func (c *Config) Site(name string) *Site {
+	if s := c.Sites[name]; s != nil {
+		return s
+	}
+	s := c.Crawl
+	return &s
+}
+
+// LoadFile reads settings from a TOML file. Settings that the file does not
+// mention keep their values; a site section starts from the crawl settings.
+// Unknown settings are an error, to catch typos.
+func (c *Config) LoadFile(path string) (err error) {
+	var file struct {
+		Config
+		Site map[string]toml.Primitive `toml:"site"`
+	}
+	file.Config = *c
+	var md toml.MetaData
+	if md, err = toml.DecodeFile(path, &file); err != nil {
+		return
+	}
+	*c = file.Config
+	for name, p := range file.Site {
+		s := c.Crawl
+		if err = md.PrimitiveDecode(p, &s); err != nil {
+			return fmt.Errorf("%s: site %s: %s", path, name, err)
+		}
+		c.Sites[name] = &s
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		return fmt.Errorf("%s: unknown setting %s", path, keys[0])
+	}
+	return
+}
+
+// EnvPrefix starts the names of the environment variables that override
+// settings. A setting's variable is named after its key, in upper case with
+// underscores for dots: SCRAPEMONSTER_DATABASE_URI for database.uri, and
+// SCRAPEMONSTER_SITE_TMON_DEPTH for site.tmon.depth.
+const EnvPrefix = "SCRAPEMONSTER_"
+
+// Older environment variables, and the settings they override, in the order
+// they are applied.
+var legacyEnv = []struct{ name, key string }{
+	{"MYSQL_CONNECTION_URI", "database.uri"},
+}
+
+// ApplyEnv overrides settings with the environment variables in environ,
+// which is in the format of os.Environ. Site settings are applied after the
+// others, so they override the crawl settings.
+func (c *Config) ApplyEnv(environ []string) error {
+	env := make(map[string]string)
+	var names []string
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+			names = append(names, kv[:i])
+		}
+	}
+	sort.Strings(names)
+
+	set := func(name, key string) error {
+		if err := c.Set(key, env[name]); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		return nil
+	}
+	for _, v := range legacyEnv {
+		if _, ok := env[v.name]; ok {
+			if err := set(v.name, v.key); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range Keys() {
+		name := EnvPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+		if _, ok := env[name]; ok {
+			if err := set(name, key); err != nil {
+				return err
+			}
+		}
+	}
+	sitePrefix := EnvPrefix + "SITE_"
+	for _, name := range names {
+		if !strings.HasPrefix(name, sitePrefix) {
+			continue
+		}
+		rest := name[len(sitePrefix):]
+		for _, key := range keys(reflect.TypeOf(Site{}), "") {
+			suffix := "_" + strings.ToUpper(key)
+			if len(rest) > len(suffix) && strings.HasSuffix(rest, suffix) {
+				site := strings.ToLower(strings.TrimSuffix(rest, suffix))
+				if err := set(name, "site."+site+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys of the settings, e.g. "database.uri", apart from
+// the per-site ones, "site.<name>.<key>", whose keys are those of the
+// crawl settings.
+func Keys() []string {
+	return keys(reflect.TypeOf(Config{}), "")
+}
+
+func keys(t reflect.Type, prefix string) (ks []string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get("toml")
+		switch {
+		case key == "-":
+		case f.Type.Kind() == reflect.Struct && f.Type != durationType:
+			ks = append(ks, keys(f.Type, prefix+key+".")...)
+		default:
+			ks = append(ks, prefix+key)
+		}
+	}
+	return
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Set sets the setting with the given key, parsing its value from a string.
+// Durations are written like "1m30s". Setting a crawl setting sets it for
+// every site.
+func (c *Config) Set(key, value string) error {
+	parts := strings.Split(key, ".")
+	if len(parts) == 3 && parts[0] == "site" {
+		s := c.Sites[parts[1]]
+		if s == nil {
+			s = c.Site(parts[1])
+			c.Sites[parts[1]] = s
+		}
+		return setField(reflect.ValueOf(s).Elem(), parts[2], value)
+	}
+	if len(parts) == 2 && parts[0] == "crawl" {
+		for _, s := range c.Sites {
+			if err := setField(reflect.ValueOf(s).Elem(), parts[1], value); err != nil {
+				return err
+			}
+		}
+	}
+	v := reflect.ValueOf(c).Elem()
+	for _, part := range parts[:len(parts)-1] {
+		if v = field(v, part); !v.IsValid() || v.Kind() != reflect.Struct {
+			return fmt.Errorf("unknown setting %s", key)
+		}
+	}
+	if err := setField(v, parts[len(parts)-1], value); err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+	return nil
+}
+
+// Returns the field of the struct v with the given key, or the zero Value.
+func field(v reflect.Value, key string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("toml") == key {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+func setField(v reflect.Value, key, value string) error {
+	f := field(v, key)
+	if !f.IsValid() || (f.Kind() == reflect.Struct && f.Type() != durationType) {
+		return fmt.Errorf("unknown setting %s", key)
+	}
+	var err error
+	switch {
+	case f.Type() == durationType:
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil {
+			f.SetInt(int64(d))
+		}
+	case f.Kind() == reflect.String:
+		f.SetString(value)
+	case f.Kind() == reflect.Int:
+		var n int64
+		if n, err = strconv.ParseInt(value, 10, 0); err == nil {
+			f.SetInt(n)
+		}
+	case f.Kind() == reflect.Float64:
+		var x float64
+		if x, err = strconv.ParseFloat(value, 64); err == nil {
+			f.SetFloat(x)
+		}
+	case f.Kind() == reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			f.SetBool(b)
+		}
+	default:
+		err = fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExample(t *testing.T) {
+	c := Default()
+	if err := c.LoadFile("example.toml"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Database.ConnMaxLifetime != 30*time.Minute || !c.Dump.Compress {
+		t.Errorf("got %+v, %+v", c.Database, c.Dump)
+	}
+	tmon := c.Site("tmon")
+	if tmon.Depth != 6 || tmon.RateLimit != 1 || tmon.Parallel != 10 || tmon.UserAgent != "MSIE8" {
+		t.Errorf("tmon: got %+v", tmon)
+	}
+	if wmp := c.Site("wmp"); *wmp != c.Crawl {
+		t.Errorf("wmp: got %+v, want the crawl settings %+v", wmp, c.Crawl)
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "scrapemonster.toml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	c := Default()
+	err := c.LoadFile(writeFile(t, `
+[database]
+uri = "from-file//"
+
+[crawl]
+depth = 3
+parallel = 3
+
+[site.tmon]
+depth = 4
+timeout = "10s"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.ApplyEnv([]string{
+		"MYSQL_CONNECTION_URI=legacy//",
+		"SCRAPEMONSTER_DATABASE_URI=sqlite:/tmp/env.db",
+		"SCRAPEMONSTER_CRAWL_PARALLEL=5",
+		"SCRAPEMONSTER_SITE_WMP_RATE_LIMIT=0.5",
+		"HOME=/root",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A flag.
+	if err := c.Set("site.tmon.timeout", "20s"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := c.Database.URI; got != "sqlite:/tmp/env.db" {
+		t.Errorf("database.uri: got %q", got)
+	}
+	for _, tt := range []struct {
+		site string
+		want Site
+	}{
+		{"tmon", Site{Depth: 4, Parallel: 5, RateLimit: 2, Burst: 1, Timeout: 20 * time.Second, UserAgent: "MSIE8"}},
+		{"wmp", Site{Depth: 3, Parallel: 5, RateLimit: 0.5, Burst: 1, Timeout: 5 * time.Second, UserAgent: "MSIE8"}},
+		{"coupang", Site{Depth: 3, Parallel: 5, RateLimit: 2, Burst: 1, Timeout: 5 * time.Second, UserAgent: "MSIE8"}},
+	} {
+		if got := *c.Site(tt.site); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.site, got, tt.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, tt := range []struct {
+		file, env, want string
+	}{
+		{file: "[crawl]\ndepht = 3\n", want: "unknown setting crawl.depht"},
+		{file: "[site.tmon]\ndepth = \"deep\"\n", want: "site tmon"},
+		{env: "SCRAPEMONSTER_CRAWL_DEPTH=deep", want: "SCRAPEMONSTER_CRAWL_DEPTH"},
+		{env: "SCRAPEMONSTER_DATABASE_BATCH_SIZE=1.5", want: "database.batch_size"},
+	} {
+		c := Default()
+		var err error
+		if tt.file != "" {
+			err = c.LoadFile(writeFile(t, tt.file))
+		} else {
+			err = c.ApplyEnv([]string{tt.env})
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q%q: got error %v, want one mentioning %q", tt.file, tt.env, err, tt.want)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	ks := strings.Join(Keys(), " ")
+	for _, key := range []string{"sites_dir", "database.uri", "dump.dir", "crawl.user_agent"} {
+		if !strings.Contains(ks, key) {
+			t.Errorf("keys %s lack %s", ks, key)
+		}
+	}
+	if strings.Contains(ks, "site.") {
+		t.Errorf("keys %s include per-site keys", ks)
+	}
+}
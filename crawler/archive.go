@@ -0,0 +1,212 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the file that lists every exchange stored in an archive.
+const archiveIndexName = "index"
+
+// Archive is a directory of recorded HTTP exchanges. Each exchange is stored
+// in its own file as the raw request head followed by the raw response
+// (status line, headers and body), or by an error message if the request
+// failed. The index file lists one exchange per line:
+//
+//	<name> <capture time in RFC 3339> <url>
+//
+// Several exchanges for the same URL (because of retries, redirects or
+// revisits) are numbered in the order they happened, so that replaying an
+// archive reproduces the original crawl.
+type Archive struct {
+	dir   string
+	mu    sync.Mutex
+	seq   map[string]int
+	index *os.File // nil unless recording
+}
+
+// CreateArchive creates a new, empty archive in the given directory.
+func CreateArchive(dir string) (a *Archive, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	var index *os.File
+	index, err = os.OpenFile(filepath.Join(dir, archiveIndexName),
+		os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return
+	}
+	a = &Archive{dir: dir, seq: make(map[string]int), index: index}
+	return
+}
+
+// OpenArchive opens an existing archive for replay.
+func OpenArchive(dir string) (a *Archive, err error) {
+	if _, err = os.Stat(filepath.Join(dir, archiveIndexName)); err != nil {
+		return
+	}
+	a = &Archive{dir: dir, seq: make(map[string]int)}
+	return
+}
+
+// Close flushes the archive index to disk.
+func (a *Archive) Close() error {
+	if a.index == nil {
+		return nil
+	}
+	if err := a.index.Sync(); err != nil {
+		a.index.Close()
+		return err
+	}
+	return a.index.Close()
+}
+
+// Returns the key and sequence number of the next exchange for a URL.
+func (a *Archive) next(url string) (key string, n int) {
+	key = fmt.Sprintf("%x", sha1.Sum([]byte(url)))
+	a.mu.Lock()
+	n = a.seq[key]
+	a.seq[key] = n + 1
+	a.mu.Unlock()
+	return
+}
+
+// Returns the name of an exchange file, relative to the archive directory.
+func archiveName(key string, n int) string {
+	return filepath.Join(key[:2], fmt.Sprintf("%s.%d", key, n))
+}
+
+func (a *Archive) path(name string) string {
+	return filepath.Join(a.dir, name)
+}
+
+// Stores one exchange. Exactly one of rsp and rspErr is non-nil.
+func (a *Archive) record(req *http.Request, rsp *http.Response, rspErr error) error {
+	var buf bytes.Buffer
+	head, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		return err
+	}
+	buf.Write(head)
+	if rspErr != nil {
+		fmt.Fprintf(&buf, "ERROR %s\n", rspErr)
+	} else {
+		// DumpResponse restores rsp.Body, so the caller can still read it.
+		data, err := httputil.DumpResponse(rsp, true)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+
+	url := req.URL.String()
+	name := archiveName(a.next(url))
+	if err := os.MkdirAll(filepath.Dir(a.path(name)), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(a.path(name))
+	if err != nil {
+		return err
+	}
+	if _, err := buf.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = fmt.Fprintf(a.index, "%s %s %s\n", name, time.Now().Format(time.RFC3339), url)
+	return err
+}
+
+// ErrNotArchived is returned when replaying a request that the archive has no
+// recording for.
+var ErrNotArchived = errors.New("crawler: url not in archive")
+
+// Loads the next recorded exchange for the given request. The last exchange
+// for a URL is served again once the recordings are used up.
+func (a *Archive) replay(req *http.Request) (*http.Response, error) {
+	key, n := a.next(req.URL.String())
+	name := archiveName(key, n)
+	data, err := ioutil.ReadFile(a.path(name))
+	if os.IsNotExist(err) && n > 0 {
+		a.mu.Lock()
+		a.seq[key] = n
+		a.mu.Unlock()
+		name = archiveName(key, n-1)
+		data, err = ioutil.ReadFile(a.path(name))
+	}
+	if os.IsNotExist(err) {
+		return nil, ErrNotArchived
+	} else if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(bytes.NewReader(data))
+	if _, err := http.ReadRequest(br); err != nil {
+		return nil, fmt.Errorf("crawler: corrupt archive file %s: %s", name, err)
+	}
+	if prefix, err := br.Peek(6); err == nil && string(prefix) == "ERROR " {
+		msg, _ := br.ReadString('\n')
+		return nil, errors.New(strings.TrimSpace(msg[6:]))
+	}
+	return http.ReadResponse(br, req)
+}
+
+// Records every exchange that passes through the wrapped RoundTripper.
+type recordingTransport struct {
+	http.RoundTripper
+	archive *Archive
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rsp, err := t.RoundTripper.RoundTrip(req)
+	if rerr := t.archive.record(req, rsp, err); rerr != nil {
+		if rsp != nil {
+			rsp.Body.Close()
+		}
+		return nil, rerr
+	}
+	return rsp, err
+}
+
+// Serves exchanges from an archive instead of the network.
+type replayTransport struct {
+	archive *Archive
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.archive.replay(req)
+}
+
+// NewRecordingGetter returns a Getter that stores every request it makes,
+// and the response it gets, in the given archive.
+func NewRecordingGetter(a *Archive) *Getter {
+	g := NewGetter()
+	g.transport = &recordingTransport{g.transport, a}
+	return g
+}
+
+// NewReplayGetter returns a Getter that never touches the network: it serves
+// every request from the given archive, as recorded by a recording Getter.
+// Failed attempts are replayed and retried just like in the original crawl,
+// but without waiting between retries.
+func NewReplayGetter(a *Archive) *Getter {
+	g := NewGetter()
+	g.transport = &replayTransport{a}
+	g.noDelay = true
+	return g
+}
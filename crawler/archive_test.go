@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "archive")
+
+	flaky := 0
+	server := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/page":
+			rsp := response(req, http.StatusOK, eucKR)
+			rsp.Header.Set("Content-Type", "text/html; charset=euc-kr")
+			return rsp, nil
+		case "/flaky":
+			if flaky++; flaky == 1 {
+				return response(req, http.StatusServiceUnavailable, "busy"), nil
+			}
+			return response(req, http.StatusOK, "ok"), nil
+		}
+		return nil, errors.New("connection refused")
+	})
+
+	a, err := CreateArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewRecordingGetter(a)
+	g.transport = &recordingTransport{server, a}
+	g.MaxRetries = 1
+	g.MinBackoff, g.MaxBackoff = time.Millisecond, time.Millisecond
+	for _, url := range []string{"http://a/page", "http://a/flaky", "http://a/down"} {
+		g.GetBody(context.Background(), url)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateArchive(dir); err == nil {
+		t.Error("created an archive over an existing one")
+	}
+	index, err := ioutil.ReadFile(filepath.Join(dir, archiveIndexName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One exchange for the page, and two for each of the others.
+	if n := strings.Count(string(index), "\n"); n != 5 {
+		t.Errorf("got %d exchanges in the index, want 5:\n%s", n, index)
+	}
+
+	a, err = OpenArchive(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g = NewReplayGetter(a)
+	g.MaxRetries = 1
+	g.MinBackoff, g.MaxBackoff = time.Hour, time.Hour
+	start := time.Now()
+	for _, tt := range []struct {
+		url, body, err string
+	}{
+		{"http://a/page", "한국어", ""},
+		{"http://a/flaky", "ok", ""},
+		{"http://a/down", "", "connection refused"},
+		// Recordings that are used up are served again.
+		{"http://a/page", "한국어", ""},
+		{"http://a/other", "", ErrNotArchived.Error()},
+	} {
+		body, err := g.GetBody(context.Background(), tt.url)
+		if string(body) != tt.body || (err == nil) != (tt.err == "") ||
+			(err != nil && !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("replaying %s: got %q, %v; want %q, %q", tt.url, body, err, tt.body, tt.err)
+		}
+		if tt.err == ErrNotArchived.Error() && !errors.Is(err, ErrNotArchived) {
+			t.Errorf("replaying %s: got %v, want ErrNotArchived", tt.url, err)
+		}
+	}
+	if d := time.Since(start); d > time.Minute {
+		t.Errorf("replay waited %s between retries", d)
+	}
+}
@@ -0,0 +1,182 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	net_url "net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Capture is a successful (2xx) response read back from an Archive or a WARC
+// file. Body has already been transcoded to UTF-8.
+type Capture struct {
+	URL    *net_url.URL
+	Time   time.Time
+	Header http.Header
+	Body   []byte
+}
+
+// Each calls f for every successful response in the archive, in the order
+// they were recorded, stopping at the first error f returns.
+func (a *Archive) Each(f func(c *Capture) error) error {
+	index, err := os.Open(filepath.Join(a.dir, archiveIndexName))
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	scanner := bufio.NewScanner(index)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(a.path(fields[0]))
+		if err != nil {
+			return err
+		}
+		br := bufio.NewReader(bytes.NewReader(data))
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return fmt.Errorf("crawler: corrupt archive file %s: %s", fields[0], err)
+		}
+		if prefix, err := br.Peek(6); err == nil && string(prefix) == "ERROR " {
+			continue
+		}
+		c, err := readCapture(br, req, fields[2], t)
+		if err != nil {
+			return fmt.Errorf("crawler: corrupt archive file %s: %s", fields[0], err)
+		}
+		if c != nil {
+			if err := f(c); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// ReadWARC calls f for every successful response record in the given WARC
+// file (compressed or not), stopping at the first error f returns.
+func ReadWARC(path string, f func(c *Capture) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	br := bufio.NewReader(r)
+	for {
+		headers, block, err := readWARCRecord(br)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("crawler: %s: %s", path, err)
+		}
+		if headers["warc-type"] != "response" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, headers["warc-date"])
+		if err != nil {
+			return fmt.Errorf("crawler: %s: %s", path, err)
+		}
+		url := headers["warc-target-uri"]
+		c, err := readCapture(bufio.NewReader(bytes.NewReader(block)), nil, url, t)
+		if err != nil {
+			return fmt.Errorf("crawler: %s: %s: %s", path, url, err)
+		}
+		if c != nil {
+			if err := f(c); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Reads one WARC record, returning its headers (with lower-cased names) and
+// its content block.
+func readWARCRecord(br *bufio.Reader) (headers map[string]string, block []byte, err error) {
+	// Skip blank lines between records.
+	var line string
+	for line == "" {
+		if line, err = br.ReadString('\n'); err != nil {
+			if err == io.EOF && strings.TrimSpace(line) != "" {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		line = strings.TrimSpace(line)
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		err = fmt.Errorf("bad record version line %q", line)
+		return
+	}
+	headers = make(map[string]string)
+	for {
+		if line, err = br.ReadString('\n'); err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if i := strings.Index(line, ":"); i > 0 {
+			key := strings.ToLower(strings.TrimSpace(line[:i]))
+			headers[key] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	n, err := strconv.Atoi(headers["content-length"])
+	if err != nil {
+		return
+	}
+	block = make([]byte, n)
+	_, err = io.ReadFull(br, block)
+	return
+}
+
+// Reads a raw HTTP response. Returns nil if it is not a 2xx response.
+func readCapture(br *bufio.Reader, req *http.Request, url string, t time.Time) (c *Capture, err error) {
+	var u *net_url.URL
+	if u, err = net_url.Parse(url); err != nil {
+		return
+	}
+	var rsp *http.Response
+	if rsp, err = http.ReadResponse(br, req); err != nil {
+		return
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return
+	}
+	var data []byte
+	if data, err = ioutil.ReadAll(rsp.Body); err != nil {
+		return
+	}
+	c = &Capture{
+		URL:    u,
+		Time:   t,
+		Header: rsp.Header,
+		Body:   toUTF8(data, rsp.Header.Get("Content-Type")),
+	}
+	return
+}
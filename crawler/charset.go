@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"bytes"
+	"code.google.com/p/go.text/encoding/korean"
+	"code.google.com/p/go.text/transform"
+	"io/ioutil"
+	"log"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+	// Matches both <meta charset="..."> and the charset parameter of
+	// <meta http-equiv="Content-Type" content="...">.
+	metaCharsetRegexp = regexp.MustCompile(
+		`(?i)<meta[^>]+charset\s*=\s*["']?\s*([-\w.:]+)`)
+)
+
+// Only this many bytes are searched for a <meta> charset declaration.
+const metaSniffLen = 1024
+
+// Labels under which servers announce EUC-KR or its superset, CP949. All of
+// them are decoded as CP949, which also handles plain EUC-KR correctly.
+var koreanCharsets = map[string]bool{
+	"cp949":          true,
+	"csksc56011987":  true,
+	"euc-kr":         true,
+	"euc_kr":         true,
+	"euckr":          true,
+	"iso-ir-149":     true,
+	"korean":         true,
+	"ks_c_5601":      true,
+	"ks_c_5601-1987": true,
+	"ks_c_5601-1989": true,
+	"ksc5601":        true,
+	"ms949":          true,
+	"uhc":            true,
+	"windows-949":    true,
+	"x-windows-949":  true,
+}
+
+// detectCharset guesses the character set of a response body. In order of
+// precedence it looks at a byte order mark, the charset parameter of the
+// Content-Type header and a <meta> declaration near the start of the body.
+// Failing all of those, a body that is not valid UTF-8 is assumed to be
+// CP949, since every site we crawl is Korean.
+func detectCharset(data []byte, contentType string) string {
+	if bytes.HasPrefix(data, utf8BOM) {
+		return "utf-8"
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if cs := params["charset"]; cs != "" {
+			return strings.ToLower(cs)
+		}
+	}
+	head := data
+	if len(head) > metaSniffLen {
+		head = head[:metaSniffLen]
+	}
+	if m := metaCharsetRegexp.FindSubmatch(head); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+	if utf8.Valid(data) {
+		return "utf-8"
+	}
+	return "cp949"
+}
+
+// toUTF8 transcodes a response body to UTF-8 based on its detected charset.
+// Bodies in charsets we don't know how to decode are returned unchanged.
+func toUTF8(data []byte, contentType string) []byte {
+	cs := detectCharset(data, contentType)
+	switch {
+	case koreanCharsets[cs]:
+		r := transform.NewReader(bytes.NewReader(data), korean.EUCKR.NewDecoder())
+		decoded, err := ioutil.ReadAll(r)
+		if err != nil {
+			log.Printf("crawler: could not decode %s body: %s", cs, err)
+			return data
+		}
+		return decoded
+	case cs == "utf-8" || cs == "utf8":
+		return bytes.TrimPrefix(data, utf8BOM)
+	}
+	return data
+}
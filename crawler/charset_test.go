@@ -0,0 +1,45 @@
+package crawler
+
+import (
+	"testing"
+)
+
+var (
+	eucKR = "\xc7\xd1\xb1\xb9\xbe\xee" // 한국어 in EUC-KR
+	cp949 = "\x8c\x63"                 // 똠, which only CP949 has
+)
+
+func TestDetectCharset(t *testing.T) {
+	for _, tt := range []struct {
+		body, contentType, want string
+	}{
+		{"\xef\xbb\xbfhello", "text/html; charset=euc-kr", "utf-8"},
+		{"hello", "text/html; charset=EUC-KR", "euc-kr"},
+		{`<meta charset="ks_c_5601-1987">` + eucKR, "text/html", "ks_c_5601-1987"},
+		{`<meta http-equiv="Content-Type" content="text/html; charset=euc-kr">`, "", "euc-kr"},
+		{"<html>" + string(make([]byte, metaSniffLen)) + `<meta charset="euc-kr">`, "", "utf-8"},
+		{"한국어", "", "utf-8"},
+		{eucKR, "", "cp949"},
+		{eucKR, "text/html; charset", "cp949"},
+	} {
+		if got := detectCharset([]byte(tt.body), tt.contentType); got != tt.want {
+			t.Errorf("detectCharset(%q, %q) = %q, want %q", tt.body, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	for _, tt := range []struct {
+		body, contentType, want string
+	}{
+		{eucKR, "text/html; charset=euc-kr", "한국어"},
+		{eucKR + cp949, "text/html; charset=ks_c_5601-1987", "한국어똠"},
+		{"<p>" + eucKR + cp949, "", "<p>한국어똠"},
+		{"\xef\xbb\xbf한국어", "text/html; charset=utf-8", "한국어"},
+		{"plain", "text/html; charset=iso-8859-1", "plain"},
+	} {
+		if got := string(toUTF8([]byte(tt.body), tt.contentType)); got != tt.want {
+			t.Errorf("toUTF8(%q, %q) = %q, want %q", tt.body, tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package crawler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	net_url "net/url"
 )
 
 type Fetcher interface {
-	Fetch(url *net_url.URL) (body string, urls []*net_url.URL, err error)
+	Fetch(ctx context.Context, url *net_url.URL) (body string, urls []*net_url.URL, err error)
 }
 
 type URLTransformer interface {
@@ -14,11 +17,24 @@ type URLTransformer interface {
 }
 
 type Result struct {
-	URL   *net_url.URL
-	Body  string
-	urls  []*net_url.URL
-	depth int
-	err   error
+	URL      *net_url.URL
+	Body     string
+	urls     []*net_url.URL
+	depth    int
+	err      error
+	frontier Frontier // to mark the URL done in, if its links were queued
+}
+
+// Done records in the Frontier that the result's URL is finished, so that a
+// resumed crawl does not fetch it again. Whoever receives a Crawler's
+// results must call it once the result has been dealt with, e.g. stored. If
+// the crawl was cancelled before the page's links were queued, the URL stays
+// pending and Done does nothing.
+func (r *Result) Done() (err error) {
+	if r.frontier != nil {
+		err = r.frontier.Done(r.URL.String())
+	}
+	return
 }
 
 type Crawler struct {
@@ -26,10 +42,17 @@ type Crawler struct {
 	URLTransformer
 	MaxParallel int
 	MaxDepth    int
-	OutputChan  chan *Result
+	Throttle    *Throttle
+	Robots      *RobotsChecker
+	Frontier    Frontier
+	OutputChan  chan *Result // see Result.Done
 	Verbose     bool
 }
 
+// The error of a result whose URL was not fetched because robots.txt
+// disallows it.
+var errDisallowed = errors.New("crawler: disallowed by robots.txt")
+
 // New returns a Crawler object, using the given Fetcher implementation.
 func New(f Fetcher) *Crawler {
 	return &Crawler{
@@ -39,53 +62,121 @@ func New(f Fetcher) *Crawler {
 	}
 }
 
-// Go begins crawling the website at the specified URL.
-func (c *Crawler) Go(startURL string) error {
+// Go begins crawling the website at the specified URL. If the Crawler's
+// Frontier has pending URLs from an earlier, interrupted crawl, the crawl
+// resumes from those instead and startURL is ignored.
+//
+// Once ctx is done, no new URLs are fetched and requests in flight are
+// abandoned; Go returns ctx.Err() after the last of them has finished. URLs
+// that were not fetched remain pending in the Frontier.
+//
+// Go closes OutputChan when it returns, whether or not it failed.
+func (c *Crawler) Go(ctx context.Context, startURL string) error {
+	if c.OutputChan != nil {
+		defer close(c.OutputChan)
+	}
 	startURL2, err := net_url.Parse(startURL)
 	if err != nil {
 		return err
 	}
+	if c.Frontier == nil {
+		c.Frontier = NewMemFrontier()
+	}
+	pending, err := c.Frontier.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		if !c.Robots.Allowed(ctx, startURL2) {
+			return fmt.Errorf("crawler: start url %s is disallowed by robots.txt", startURL)
+		}
+		added, err := c.Frontier.Add(startURL2.String(), c.MaxDepth)
+		if err != nil {
+			return err
+		}
+		if added {
+			pending = []FrontierEntry{{startURL2.String(), c.MaxDepth}}
+		}
+	} else if c.Verbose {
+		log.Printf("crawler: resuming crawl with %d pending urls", len(pending))
+	}
 
 	resultChan := make(chan *Result)
 	sem := make(chan int, c.MaxParallel)
 	fetch := func(url *net_url.URL, depth int) {
 		go func() {
 			sem <- 1
-			body, urls, err := c.Fetch(url)
-			resultChan <- &Result{url, body, c.transformURLs(urls), depth, err}
+			var (
+				body string
+				urls []*net_url.URL
+				err  error
+			)
+			// Checked here rather than when the URL is queued, so that
+			// fetching one host's robots.txt doesn't hold up the others.
+			if !c.Robots.Allowed(ctx, url) {
+				err = errDisallowed
+			} else if err = c.Throttle.Wait(ctx, url.Host); err == nil {
+				body, urls, err = c.Fetch(ctx, url)
+			}
+			resultChan <- &Result{url, body, c.transformURLs(urls), depth, err, nil}
 			<-sem
 		}()
 	}
 
-	go fetch(startURL2, c.MaxDepth)
-	visited := map[string]bool{startURL2.String(): true}
-	nprocs := 1
+	nprocs := 0
+	for _, e := range pending {
+		url, err := net_url.Parse(e.URL)
+		if err != nil {
+			log.Printf("crawler: frontier: %s", err)
+			continue
+		}
+		go fetch(url, e.Depth)
+		nprocs++
+	}
 
 	for nprocs > 0 {
 		r := <-resultChan
 		nprocs--
-		if r.depth > 0 {
+		if r.err != nil && ctx.Err() != nil {
+			// Cancelled: leave the URL pending for a resumed crawl.
+			continue
+		}
+		// After a cancellation the page's links are not queued, so it must
+		// stay pending for a resumed crawl to queue them.
+		linksQueued := r.depth == 0 || ctx.Err() == nil
+		if r.depth > 0 && linksQueued {
 			for _, url := range r.urls {
-				key := url.String()
-				if !visited[key] {
+				added, err := c.Frontier.Add(url.String(), r.depth-1)
+				if err != nil {
+					log.Printf("crawler: frontier: %s", err)
+				}
+				if added {
 					go fetch(url, r.depth-1)
-					visited[key] = true
 					nprocs++
 				}
 			}
 		}
-		if r.err != nil {
-			log.Printf("crawler: %s", r.err)
-		} else if c.OutputChan != nil {
+		if linksQueued {
+			r.frontier = c.Frontier
+		}
+		if r.err == nil && c.OutputChan != nil {
+			// The receiver marks the URL done once it has dealt with it.
 			c.OutputChan <- r
+			continue
+		}
+		if r.err == errDisallowed {
+			if c.Verbose {
+				log.Printf("crawler: %s: %s", r.URL, r.err)
+			}
+		} else if r.err != nil {
+			log.Printf("crawler: %s", r.err)
+		}
+		if err := r.Done(); err != nil {
+			log.Printf("crawler: frontier: %s", err)
 		}
 	}
 
-	if c.OutputChan != nil {
-		close(c.OutputChan)
-	}
-
-	return nil
+	return ctx.Err()
 }
 
 func (c *Crawler) transformURLs(urls []*net_url.URL) (newurls []*net_url.URL) {
@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	net_url "net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A Fetcher that serves pages from a map of URLs to the links on them.
+type fakeFetcher struct {
+	links   map[string][]string
+	fetched chan string
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, url *net_url.URL) (body string, urls []*net_url.URL, err error) {
+	f.fetched <- url.String()
+	for _, s := range f.links[url.String()] {
+		u, _ := net_url.Parse(s)
+		urls = append(urls, u)
+	}
+	return
+}
+
+type fetcherFunc func(ctx context.Context, url *net_url.URL) (string, []*net_url.URL, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, url *net_url.URL) (string, []*net_url.URL, error) {
+	return f(ctx, url)
+}
+
+type identityTransformer struct{}
+
+func (identityTransformer) TransformURL(url *net_url.URL) *net_url.URL { return url }
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// Returns a response with the given status and body.
+func response(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func TestSlowRobotsDoesNotStallOtherHosts(t *testing.T) {
+	// slow.example takes until release is closed to serve its robots.txt;
+	// nobody has one.
+	release := make(chan bool)
+	rc := NewRobotsChecker(NewTransportGetter(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "slow.example" {
+			select {
+			case <-release:
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+		return response(req, http.StatusNotFound, ""), nil
+	})))
+	f := &fakeFetcher{
+		links: map[string][]string{
+			"http://fast.example/": {"http://slow.example/a", "http://fast.example/b"},
+		},
+		fetched: make(chan string, 10),
+	}
+	c := New(f)
+	c.URLTransformer = identityTransformer{}
+	c.Robots = rc
+	done := make(chan error, 1)
+	go func() { done <- c.Go(context.Background(), "http://fast.example/") }()
+
+	for _, want := range []string{"http://fast.example/", "http://fast.example/b"} {
+		select {
+		case got := <-f.fetched:
+			if got != want {
+				t.Errorf("fetched %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			close(release)
+			t.Fatalf("%s not fetched while slow.example's robots.txt was pending", want)
+		}
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := <-f.fetched; got != "http://slow.example/a" {
+		t.Errorf("fetched %s, want http://slow.example/a", got)
+	}
+}
+
+// A cancelled crawl returns context.Canceled, closes OutputChan, and leaves
+// the page it abandoned pending.
+func TestCrawlerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan bool)
+	c := New(fetcherFunc(func(ctx context.Context, url *net_url.URL) (string, []*net_url.URL, error) {
+		if url.Path == "/slow" {
+			close(started)
+			<-ctx.Done()
+			return "", nil, ctx.Err()
+		}
+		slow, _ := net_url.Parse("http://a/slow")
+		return "", []*net_url.URL{slow}, nil
+	}))
+	c.URLTransformer = identityTransformer{}
+	c.OutputChan = make(chan *Result)
+	received := make(chan bool)
+	go func() {
+		defer close(received)
+		for r := range c.OutputChan {
+			r.Done()
+		}
+	}()
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	if err := c.Go(ctx, "http://a/"); err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OutputChan not closed")
+	}
+	want := []FrontierEntry{{"http://a/slow", c.MaxDepth - 1}}
+	if pending, _ := c.Frontier.Pending(); !reflect.DeepEqual(pending, want) {
+		t.Errorf("got pending %v, want %v", pending, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"code.google.com/p/go.net/html"
 	"code.google.com/p/go.net/html/atom"
+	"context"
 	net_url "net/url"
 )
 
@@ -22,10 +23,10 @@ type SimpleFetcher struct {
 // Fetch requests the specified URL and returns the response body plus all
 // links URLs found in the body (see also parseLinks). Only returns URLs whose
 // hostname exactly matches the hostname of the source URL.
-func (f SimpleFetcher) Fetch(url *net_url.URL) (body string, urls []*net_url.URL, err error) {
+func (f SimpleFetcher) Fetch(ctx context.Context, url *net_url.URL) (body string, urls []*net_url.URL, err error) {
 	// Fetch the url body.
 	var data []byte
-	data, err = f.GetBody(url.String())
+	data, err = f.GetBody(ctx, url.String())
 	if err != nil {
 		return
 	}
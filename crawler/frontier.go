@@ -0,0 +1,193 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Frontier keeps track of which URLs a Crawler has seen and which of them
+// are still waiting to be fetched. A persistent Frontier lets a crawl be
+// resumed after it was interrupted.
+type Frontier interface {
+	// Add records that url has been queued for fetching at the given
+	// depth. It returns false, and records nothing, if url was already
+	// added at some point.
+	Add(url string, depth int) (added bool, err error)
+
+	// Done records that url has been fetched and its links added.
+	Done(url string) error
+
+	// Pending returns the URLs that were added but are not done, in the
+	// order they were added.
+	Pending() ([]FrontierEntry, error)
+
+	Close() error
+}
+
+// FrontierEntry is a queued URL and its remaining crawl depth.
+type FrontierEntry struct {
+	URL   string
+	Depth int
+}
+
+// memFrontier is a Frontier that lives only in memory.
+type memFrontier struct {
+	mu      sync.Mutex
+	entries map[string]*frontierState
+	order   []string
+}
+
+type frontierState struct {
+	depth int
+	done  bool
+}
+
+// NewMemFrontier returns a Frontier that is not persisted anywhere.
+func NewMemFrontier() Frontier {
+	return &memFrontier{entries: make(map[string]*frontierState)}
+}
+
+func (f *memFrontier) Add(url string, depth int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.add(url, depth), nil
+}
+
+func (f *memFrontier) add(url string, depth int) bool {
+	if _, ok := f.entries[url]; ok {
+		return false
+	}
+	f.entries[url] = &frontierState{depth: depth}
+	f.order = append(f.order, url)
+	return true
+}
+
+func (f *memFrontier) Done(url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done(url)
+	return nil
+}
+
+func (f *memFrontier) done(url string) {
+	if e := f.entries[url]; e != nil {
+		e.done = true
+	}
+}
+
+func (f *memFrontier) Pending() (pending []FrontierEntry, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, url := range f.order {
+		if e := f.entries[url]; !e.done {
+			pending = append(pending, FrontierEntry{url, e.depth})
+		}
+	}
+	return
+}
+
+func (f *memFrontier) Close() error {
+	return nil
+}
+
+// FileFrontier is a Frontier backed by an append-only log file. Every Add and
+// Done is written to the file immediately, so the state survives a crash of
+// the process. The log has one record per line:
+//
+//	A <depth> <url>
+//	D <url>
+type FileFrontier struct {
+	memFrontier
+	file *os.File
+}
+
+// OpenFileFrontier opens (creating it if necessary) the frontier log at the
+// given path and replays it. If truncate is true, any previous contents are
+// discarded and the crawl starts from scratch.
+func OpenFileFrontier(path string, truncate bool) (f *FileFrontier, err error) {
+	flags := os.O_RDWR | os.O_CREATE
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	var file *os.File
+	file, err = os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return
+	}
+	f = &FileFrontier{file: file}
+	f.entries = make(map[string]*frontierState)
+	if err = f.replay(); err != nil {
+		file.Close()
+		f = nil
+	}
+	return
+}
+
+// Rebuilds the in-memory state from the log, leaving the file positioned at
+// its end. A truncated final line (from a crash mid-write) is cut off.
+func (f *FileFrontier) replay() error {
+	var (
+		r      = bufio.NewReader(f.file)
+		offset int64
+	)
+	for lineno := 1; ; lineno++ {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "A":
+			depth, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return fmt.Errorf("%s:%d: bad depth: %s", f.file.Name(), lineno, err)
+			}
+			f.add(fields[2], depth)
+		case len(fields) == 2 && fields[0] == "D":
+			f.done(fields[1])
+		default:
+			return fmt.Errorf("%s:%d: malformed record", f.file.Name(), lineno)
+		}
+		offset += int64(len(line))
+	}
+	if err := f.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := f.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (f *FileFrontier) Add(url string, depth int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.add(url, depth) {
+		return false, nil
+	}
+	_, err := fmt.Fprintf(f.file, "A %d %s\n", depth, url)
+	return true, err
+}
+
+func (f *FileFrontier) Done(url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done(url)
+	_, err := fmt.Fprintf(f.file, "D %s\n", url)
+	return err
+}
+
+func (f *FileFrontier) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
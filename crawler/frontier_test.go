@@ -0,0 +1,135 @@
+package crawler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileFrontier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frontier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "frontier.log")
+
+	f, err := OpenFileFrontier(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{"http://a/", "http://b/", "http://c/"} {
+		if added, err := f.Add(url, 3); !added || err != nil {
+			t.Fatalf("Add(%s) = %v, %v", url, added, err)
+		}
+	}
+	if added, _ := f.Add("http://a/", 1); added {
+		t.Error("added http://a/ twice")
+	}
+	if err := f.Done("http://b/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash in the middle of a write leaves a partial last line.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("D http://a")
+	file.Close()
+
+	want := []FrontierEntry{{"http://a/", 3}, {"http://c/", 3}}
+	f, err = OpenFileFrontier(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := f.Pending(); !reflect.DeepEqual(pending, want) {
+		t.Errorf("after replay: got pending %v, want %v", pending, want)
+	}
+	if added, _ := f.Add("http://b/", 3); added {
+		t.Error("added http://b/ again after replay")
+	}
+	f.Add("http://d/", 2)
+	f.Close()
+
+	f, err = OpenFileFrontier(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, FrontierEntry{"http://d/", 2})
+	if pending, _ := f.Pending(); !reflect.DeepEqual(pending, want) {
+		t.Errorf("after a write past the partial line: got pending %v, want %v", pending, want)
+	}
+	f.Close()
+
+	f, err = OpenFileFrontier(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := f.Pending(); len(pending) != 0 {
+		t.Errorf("truncated: got pending %v", pending)
+	}
+	f.Close()
+}
+
+func TestFileFrontierMalformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frontier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, tt := range []struct {
+		log, want string
+	}{
+		{"A x http://a/\n", "bad depth"},
+		{"A 1 http://a/\nX http://a/\n", ":2: malformed record"},
+		{"D\n", "malformed record"},
+	} {
+		path := filepath.Join(dir, "frontier"+string(rune('a'+i)))
+		if err := ioutil.WriteFile(path, []byte(tt.log), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenFileFrontier(path, false); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %v, want one mentioning %q", tt.log, err, tt.want)
+		}
+	}
+}
+
+// A page stays pending until whoever receives it from OutputChan says it is
+// done with it.
+func TestCrawlerResultDone(t *testing.T) {
+	f := &fakeFetcher{
+		links: map[string][]string{
+			"http://a/": {"http://a/1", "http://a/2"},
+		},
+		fetched: make(chan string, 10),
+	}
+	c := New(f)
+	c.URLTransformer = identityTransformer{}
+	c.MaxDepth = 1
+	c.OutputChan = make(chan *Result)
+	received := make(chan bool)
+	go func() {
+		defer close(received)
+		for r := range c.OutputChan {
+			if r.URL.String() != "http://a/2" {
+				r.Done()
+			}
+		}
+	}()
+	if err := c.Go(context.Background(), "http://a/"); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+	want := []FrontierEntry{{"http://a/2", 0}}
+	if pending, _ := c.Frontier.Pending(); !reflect.DeepEqual(pending, want) {
+		t.Errorf("got pending %v, want %v", pending, want)
+	}
+}
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"net"
@@ -18,11 +19,26 @@ type Getter struct {
 	UserAgent string
 	Timeout   time.Duration
 	Verbose   bool
-	transport *http.Transport
+	Throttle  *Throttle      // optional per-host rate limit
+	Robots    *RobotsChecker // optional robots.txt enforcement
+
+	// Failed requests are retried up to MaxRetries times, waiting a
+	// randomized, exponentially growing delay between MinBackoff and
+	// MaxBackoff before each retry.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	transport http.RoundTripper
+	noDelay   bool // retry at once (when replaying an archive)
 }
 
 func NewGetter() *Getter {
-	g := new(Getter)
+	g := &Getter{
+		MaxRetries: 3,
+		MinBackoff: 500 * time.Millisecond,
+		MaxBackoff: 30 * time.Second,
+	}
 	g.transport = &http.Transport{
 		Dial: func(network, addr string) (net.Conn, error) {
 			if g.Timeout.Nanoseconds() > 0 {
@@ -34,7 +50,23 @@ func NewGetter() *Getter {
 	return g
 }
 
-func (g *Getter) GetBody(url string) (data []byte, err error) {
+// NewTransportGetter returns a Getter that sends its requests through the
+// given RoundTripper rather than the network, which lets tests serve saved
+// pages. It does not retry failed requests.
+func NewTransportGetter(rt http.RoundTripper) *Getter {
+	g := NewGetter()
+	g.transport = rt
+	g.MaxRetries = 0
+	return g
+}
+
+// GetBody requests the given URL and returns the response body, transcoded
+// to UTF-8 if necessary (see detectCharset). Timeouts, connection errors,
+// 5xx and 429 responses are retried up to MaxRetries times with exponential
+// backoff. Any response that is not a 2xx, or a request that still fails
+// after its last retry, yields an *HTTPError. The request is abandoned as
+// soon as ctx is done.
+func (g *Getter) GetBody(ctx context.Context, url string) (data []byte, err error) {
 	// Build a map of HTTP headers.
 	headers := make(map[string]string)
 	if g.UserAgent != "" {
@@ -47,21 +79,96 @@ func (g *Getter) GetBody(url string) (data []byte, err error) {
 	if err != nil {
 		return
 	}
+	req = req.WithContext(ctx)
 	for k, v := range headers {
 		req.Header.Add(k, v)
 	}
 
+	// Refuse to fetch URLs disallowed by robots.txt.
+	if !g.Robots.Allowed(ctx, req.URL) {
+		err = ErrBlockedByRobots
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		var (
+			retry      bool
+			retryAfter time.Duration
+		)
+		data, retry, retryAfter, err = g.try(req)
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+		if e, ok := err.(*HTTPError); ok {
+			e.Attempts = attempt
+		}
+		if !retry || attempt > g.MaxRetries {
+			return
+		}
+		delay := Backoff(attempt, g.MinBackoff, g.MaxBackoff)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if g.noDelay {
+			delay = 0
+		}
+		if g.Verbose {
+			log.Printf("%s; retrying in %s", err, delay)
+		}
+		if err = sleep(ctx, delay); err != nil {
+			return
+		}
+	}
+}
+
+// Makes a single attempt at the given request. Returns whether a failed
+// request is worth retrying and how long the server asked us to wait.
+func (g *Getter) try(req *http.Request) (data []byte, retry bool, retryAfter time.Duration, err error) {
+	// Wait for our turn if this host is being throttled.
+	if err = g.Throttle.Wait(req.Context(), req.URL.Host); err != nil {
+		return
+	}
+
 	// Send the request and read the response body.
 	client := &http.Client{Transport: g.transport}
 	if g.Verbose {
-		log.Printf("GET %s", url)
+		log.Printf("GET %s", req.URL)
 	}
 	var rsp *http.Response
 	rsp, err = client.Do(req)
 	if err != nil {
+		// Transport errors (timeouts, refused connections, resets) are
+		// usually transient.
+		err = &HTTPError{URL: req.URL.String(), Err: err}
+		retry = true
 		return
 	}
 	defer rsp.Body.Close()
 	data, err = ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		err = &HTTPError{URL: req.URL.String(), Err: err}
+		retry = true
+		return
+	}
+
+	// Never hand an error page to the caller.
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		data = nil
+		err = &HTTPError{
+			URL:        req.URL.String(),
+			StatusCode: rsp.StatusCode,
+			Status:     rsp.Status,
+		}
+		retry = retryableStatus(rsp.StatusCode)
+		retryAfter = parseRetryAfter(rsp.Header.Get("Retry-After"), time.Now())
+		return
+	}
+
+	// Callers always get UTF-8, whatever the server sent.
+	data = toUTF8(data, rsp.Header.Get("Content-Type"))
 	return
 }
@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPError is returned by Getter.GetBody when a request fails, either
+// because the server answered with a non-2xx status or because the request
+// could not be completed at all (in which case StatusCode is 0 and Err holds
+// the underlying error, which errors.Is and errors.As see through Unwrap).
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Attempts   int
+	Err        error
+}
+
+func (e *HTTPError) Error() string {
+	what := e.Status
+	if e.Err != nil {
+		what = e.Err.Error()
+	}
+	return fmt.Sprintf("GET %s: %s (%d attempts)", e.URL, what, e.Attempts)
+}
+
+// Unwrap returns the error that kept the request from completing, if any.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// NotFound reports whether the server said the resource does not exist.
+func (e *HTTPError) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+}
+
+// Reports whether a response with the given status code is worth retrying.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
+
+// Backoff returns the delay before the given retry (starting at 1) of an
+// operation: a random duration between half and all of min*2^(attempt-1),
+// capped at max. It is used by Getter, and by anything else that retries
+// with the same policy.
+func Backoff(attempt int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Parses the value of a Retry-After header, which is either a number of
+// seconds or an HTTP date. Returns zero if the header is absent or invalid.
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(s); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
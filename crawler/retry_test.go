@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, tt := range []struct {
+		attempt  int
+		min, max time.Duration
+		want     time.Duration // before jitter, which takes off up to half
+	}{
+		{1, time.Second, 30 * time.Second, time.Second},
+		{2, time.Second, 30 * time.Second, 2 * time.Second},
+		{4, time.Second, 30 * time.Second, 8 * time.Second},
+		{10, time.Second, 30 * time.Second, 30 * time.Second},
+		{3, time.Second, 0, time.Second},
+		{3, 0, time.Second, 0},
+	} {
+		for i := 0; i < 20; i++ {
+			if d := Backoff(tt.attempt, tt.min, tt.max); d < tt.want/2 || d > tt.want {
+				t.Errorf("Backoff(%d, %s, %s) = %s, want between %s and %s",
+					tt.attempt, tt.min, tt.max, d, tt.want/2, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{"soon", 0},
+		{"Wed, 01 May 2013 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 May 2013 11:00:00 GMT", 0},
+	} {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	for code, want := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusNotFound:            false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+	} {
+		if got := retryableStatus(code); got != want {
+			t.Errorf("retryableStatus(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestHTTPErrorUnwrap(t *testing.T) {
+	var err error = &HTTPError{URL: "http://example.com/", Err: context.DeadlineExceeded}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("errors.Is(%v, context.DeadlineExceeded) = false", err)
+	}
+}
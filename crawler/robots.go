@@ -0,0 +1,258 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"log"
+	net_url "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBlockedByRobots is returned by Getter.GetBody when the requested URL is
+// disallowed by the host's robots.txt.
+var ErrBlockedByRobots = errors.New("crawler: blocked by robots.txt")
+
+// RobotsChecker decides whether URLs may be fetched according to the
+// robots.txt file of their host. Each host's robots.txt is fetched once and
+// cached; a fetch abandoned because its context was done is retried by the
+// next caller. It is safe for concurrent use.
+type RobotsChecker struct {
+	Getter    *Getter
+	UserAgent string    // matched against the User-agent lines of robots.txt
+	Throttle  *Throttle // if set, receives each host's Crawl-delay
+	Verbose   bool
+	mu        sync.Mutex
+	hosts     map[string]*robotsEntry
+	allowlist map[string][]string
+	blocked   map[string]int
+}
+
+type robotsEntry struct {
+	mu    sync.Mutex   // held while fetching
+	rules *robotsRules // nil until fetched
+}
+
+// NewRobotsChecker returns a RobotsChecker that fetches robots.txt files with
+// the given Getter.
+func NewRobotsChecker(g *Getter) *RobotsChecker {
+	return &RobotsChecker{
+		Getter:    g,
+		hosts:     make(map[string]*robotsEntry),
+		allowlist: make(map[string][]string),
+		blocked:   make(map[string]int),
+	}
+}
+
+// Allow exempts paths on the given host from robots.txt. Patterns use
+// robots.txt syntax.
+func (rc *RobotsChecker) Allow(host string, patterns ...string) {
+	rc.mu.Lock()
+	rc.allowlist[host] = append(rc.allowlist[host], patterns...)
+	rc.mu.Unlock()
+}
+
+// Allowed reports whether the given URL may be fetched. A nil RobotsChecker
+// allows everything. Disallowed URLs are counted (see Blocked).
+func (rc *RobotsChecker) Allowed(ctx context.Context, u *net_url.URL) bool {
+	if rc == nil || u.Path == "/robots.txt" {
+		return true
+	}
+	path := u.RequestURI()
+	rc.mu.Lock()
+	allowlist := rc.allowlist[u.Host]
+	rc.mu.Unlock()
+	for _, pattern := range allowlist {
+		if robotsMatch(pattern, path) {
+			return true
+		}
+	}
+	if rc.rulesFor(ctx, u).allowed(path) {
+		return true
+	}
+	rc.mu.Lock()
+	rc.blocked[u.Host]++
+	rc.mu.Unlock()
+	if rc.Verbose {
+		log.Printf("robots.txt disallows %s", u)
+	}
+	return false
+}
+
+// Blocked returns the number of URLs disallowed so far, keyed by host.
+func (rc *RobotsChecker) Blocked() map[string]int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	m := make(map[string]int, len(rc.blocked))
+	for host, n := range rc.blocked {
+		m[host] = n
+	}
+	return m
+}
+
+func (rc *RobotsChecker) rulesFor(ctx context.Context, u *net_url.URL) *robotsRules {
+	rc.mu.Lock()
+	e := rc.hosts[u.Host]
+	if e == nil {
+		e = new(robotsEntry)
+		rc.hosts[u.Host] = e
+	}
+	rc.mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rules == nil {
+		if e.rules = rc.fetch(ctx, u); e.rules == nil {
+			// Whatever the caller wanted to fetch won't be fetched either.
+			return new(robotsRules)
+		}
+	}
+	return e.rules
+}
+
+// Fetches and parses the robots.txt file for the host of the given URL. If
+// the file can't be retrieved, everything is allowed. Returns nil if ctx was
+// done before the file was retrieved.
+func (rc *RobotsChecker) fetch(ctx context.Context, u *net_url.URL) *robotsRules {
+	robotsURL := &net_url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	data, err := rc.Getter.GetBody(ctx, robotsURL.String())
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		// A missing robots.txt is normal and means everything is allowed.
+		if e, ok := err.(*HTTPError); !ok || e.StatusCode < 400 || e.StatusCode > 499 {
+			log.Printf("crawler: %s", err)
+		}
+		return new(robotsRules)
+	}
+	rules := parseRobots(string(data), rc.UserAgent)
+	if rules.crawlDelay > 0 && rc.Throttle != nil {
+		l := rc.Throttle.Limit(u.Host)
+		if l.MinDelay < rules.crawlDelay {
+			l.MinDelay = rules.crawlDelay
+			rc.Throttle.SetLimit(u.Host, l)
+		}
+	}
+	return rules
+}
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// The subset of a robots.txt file that applies to one user agent.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// Reports whether the given path (plus query string) may be fetched. The
+// longest matching pattern wins; Allow wins a tie.
+func (r *robotsRules) allowed(path string) bool {
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > longest || (n == longest && rule.allow) {
+			allow, longest = rule.allow, n
+		}
+	}
+	return allow
+}
+
+type robotsGroup struct {
+	agents []string
+	robotsRules
+}
+
+// Parses a robots.txt file and returns the rules of the group that best
+// matches userAgent, falling back to the "*" group.
+func parseRobots(body string, userAgent string) *robotsRules {
+	var (
+		groups []*robotsGroup
+		g      *robotsGroup
+		inUA   bool // true while reading consecutive User-agent lines
+	)
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			if !inUA {
+				g = new(robotsGroup)
+				groups = append(groups, g)
+			}
+			g.agents = append(g.agents, strings.ToLower(val))
+			inUA = true
+			continue
+		case "allow", "disallow":
+			// An empty Disallow means "allow everything".
+			if g != nil && val != "" {
+				g.rules = append(g.rules, robotsRule{val, key == "allow"})
+			}
+		case "crawl-delay":
+			if g != nil {
+				if secs, err := strconv.ParseFloat(val, 64); err == nil && secs > 0 {
+					g.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+		inUA = false
+	}
+
+	ua := strings.ToLower(userAgent)
+	var best *robotsGroup
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				if best == nil {
+					best = g
+				}
+			} else if agent != "" && strings.Contains(ua, agent) {
+				return &g.robotsRules
+			}
+		}
+	}
+	if best != nil {
+		return &best.robotsRules
+	}
+	return new(robotsRules)
+}
+
+// Matches a robots.txt path pattern against a path. Patterns are prefixes
+// that may contain '*' wildcards and may be anchored with a trailing '$'.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+	for _, part := range parts[1:] {
+		i := strings.Index(path, part)
+		if i < 0 {
+			return false
+		}
+		path = path[i+len(part):]
+	}
+	if anchored && path != "" {
+		// The last literal may also occur later on; the path must end with it.
+		last := parts[len(parts)-1]
+		return len(parts) > 1 && strings.HasSuffix(path, last)
+	}
+	return true
+}
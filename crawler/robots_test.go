@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	net_url "net/url"
+	"testing"
+	"time"
+)
+
+func TestRobotsMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/deal", "/deal/1", true},
+		{"/deal", "/deallist", true},
+		{"/deal/", "/deallist", false},
+		{"/*.php", "/x/index.php?a=1", true},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?a=1", false},
+		{"/*.php$", "/a.php/b.php", true},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"/search*q=", "/search?x=1&q=2", true},
+		{"/search*q=", "/search?x=1", false},
+	} {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+const testRobots = `
+# Everyone else
+User-agent: *
+Disallow: /order
+Disallow: /deal/*/buy
+Allow: /order/help
+
+User-agent: ScrapeBot
+User-agent: OtherBot
+Disallow: /
+Allow: /deal    # deals only
+Crawl-delay: 1.5
+
+User-agent: Quiet
+Disallow:
+`
+
+func TestParseRobots(t *testing.T) {
+	for _, tt := range []struct {
+		userAgent string
+		path      string
+		want      bool
+	}{
+		{"Mozilla/5.0", "/deal/1", true},
+		{"Mozilla/5.0", "/order/1", false},
+		{"Mozilla/5.0", "/order/help", true},
+		{"Mozilla/5.0", "/deal/1/buy", false},
+		{"scrapebot/1.0", "/deal/1", true},
+		{"scrapebot/1.0", "/home", false},
+		{"OtherBot", "/home", false},
+		{"Quiet", "/order/1", true},
+		{"", "/order/1", false},
+	} {
+		if got := parseRobots(testRobots, tt.userAgent).allowed(tt.path); got != tt.want {
+			t.Errorf("%q may fetch %s: got %v, want %v", tt.userAgent, tt.path, got, tt.want)
+		}
+	}
+	if d := parseRobots(testRobots, "ScrapeBot").crawlDelay; d != 1500*time.Millisecond {
+		t.Errorf("got Crawl-delay %s, want 1.5s", d)
+	}
+	if d := parseRobots(testRobots, "Mozilla/5.0").crawlDelay; d != 0 {
+		t.Errorf("got Crawl-delay %s for the * group, want none", d)
+	}
+	if !parseRobots("", "ScrapeBot").allowed("/anything") {
+		t.Error("an empty robots.txt disallows")
+	}
+}
+
+func TestRobotsChecker(t *testing.T) {
+	fetches := 0
+	rc := NewRobotsChecker(NewTransportGetter(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		fetches++
+		if req.URL.Host == "missing.example" {
+			return response(req, http.StatusNotFound, ""), nil
+		}
+		return response(req, http.StatusOK, testRobots), nil
+	})))
+	rc.UserAgent = "ScrapeBot"
+	rc.Throttle = NewThrottle(RateLimit{MinDelay: time.Second})
+	rc.Allow("www.example", "/home$")
+
+	for _, tt := range []struct {
+		url  string
+		want bool
+	}{
+		{"http://www.example/deal/1", true},
+		{"http://www.example/order/1", false},
+		{"http://www.example/home", true},
+		{"http://www.example/home/2", false},
+		{"http://www.example/robots.txt", true},
+		{"http://missing.example/order/1", true},
+	} {
+		u, _ := net_url.Parse(tt.url)
+		if got := rc.Allowed(context.Background(), u); got != tt.want {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("fetched robots.txt %d times, want once per host", fetches)
+	}
+	if got := rc.Blocked()["www.example"]; got != 2 {
+		t.Errorf("got %d blocked URLs, want 2", got)
+	}
+	// The Crawl-delay raised the host's minimum delay, and only that host's.
+	if l := rc.Throttle.Limit("www.example"); l.MinDelay != 1500*time.Millisecond {
+		t.Errorf("got min delay %s for www.example, want 1.5s", l.MinDelay)
+	}
+	if l := rc.Throttle.Limit("missing.example"); l.MinDelay != time.Second {
+		t.Errorf("got min delay %s for missing.example, want 1s", l.MinDelay)
+	}
+}
+
+func TestRobotsCheckerCancelledFetch(t *testing.T) {
+	rc := NewRobotsChecker(NewTransportGetter(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		return response(req, http.StatusOK, "User-agent: *\nDisallow: /\n"), nil
+	})))
+	u, _ := net_url.Parse("http://www.example/deal/1")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rc.Allowed(ctx, u)
+	// The abandoned fetch is not cached, so the next caller gets the rules.
+	if rc.Allowed(context.Background(), u) {
+		t.Error("Allowed after a cancelled fetch: got true, want false")
+	}
+}
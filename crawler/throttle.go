@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit describes how politely a single host should be treated.
+type RateLimit struct {
+	PerSecond float64       // sustained requests per second; 0 means unlimited
+	Burst     int           // requests allowed back-to-back before PerSecond applies
+	MinDelay  time.Duration // minimum spacing between consecutive requests
+}
+
+// Throttle enforces a RateLimit per host. It is safe for concurrent use, so a
+// single Throttle can be shared by a Crawler and any number of Getters to
+// keep all of their requests within the same per-host budget.
+type Throttle struct {
+	Default RateLimit
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	hosts   map[string]*hostState
+}
+
+type hostState struct {
+	tokens   float64
+	refilled time.Time
+	prev     time.Time
+}
+
+// NewThrottle returns a Throttle that applies the given limit to every host
+// that does not have a limit of its own (see SetLimit).
+func NewThrottle(def RateLimit) *Throttle {
+	return &Throttle{
+		Default: def,
+		limits:  make(map[string]RateLimit),
+		hosts:   make(map[string]*hostState),
+	}
+}
+
+// SetLimit overrides the default limit for the given host.
+func (t *Throttle) SetLimit(host string, l RateLimit) {
+	t.mu.Lock()
+	t.limits[host] = l
+	t.mu.Unlock()
+}
+
+// Limit returns the limit in effect for the given host.
+func (t *Throttle) Limit(host string) RateLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit(host)
+}
+
+func (t *Throttle) limit(host string) RateLimit {
+	if l, ok := t.limits[host]; ok {
+		return l
+	}
+	return t.Default
+}
+
+// Wait blocks until a request to the given host is allowed, or until ctx is
+// done, in which case it returns ctx.Err(). A nil Throttle never blocks.
+func (t *Throttle) Wait(ctx context.Context, host string) error {
+	if t == nil {
+		return ctx.Err()
+	}
+	if d := t.reserve(host, time.Now()); d > 0 {
+		return sleep(ctx, d)
+	}
+	return ctx.Err()
+}
+
+// Sleeps for the given duration or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reserves the next request slot for host and returns how long the caller
+// must wait before using it.
+func (t *Throttle) reserve(host string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := t.limit(host)
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	h := t.hosts[host]
+	if h == nil {
+		h = &hostState{tokens: burst, refilled: now}
+		t.hosts[host] = h
+	}
+	at := now
+	if l.PerSecond > 0 {
+		// Refill the bucket, then take a token. A negative balance is a
+		// debt that later callers have to wait out.
+		elapsed := now.Sub(h.refilled).Seconds()
+		h.tokens = math.Min(burst, h.tokens+elapsed*l.PerSecond)
+		h.refilled = now
+		h.tokens--
+		if h.tokens < 0 {
+			at = now.Add(time.Duration(-h.tokens / l.PerSecond * float64(time.Second)))
+		}
+	}
+	if next := h.prev.Add(l.MinDelay); at.Before(next) {
+		at = next
+	}
+	h.prev = at
+	return at.Sub(now)
+}
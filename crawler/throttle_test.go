@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottleReserve(t *testing.T) {
+	type request struct {
+		host string
+		at   time.Duration // since the first request
+		want time.Duration // wait
+	}
+	for _, tt := range []struct {
+		name  string
+		limit RateLimit
+		reqs  []request
+	}{
+		{"unlimited", RateLimit{}, []request{
+			{"a", 0, 0}, {"a", 0, 0}, {"a", 0, 0},
+		}},
+		{"burst then rate", RateLimit{PerSecond: 2, Burst: 2}, []request{
+			{"a", 0, 0},
+			{"a", 0, 0},
+			{"a", 0, 500 * time.Millisecond},
+			{"a", 0, time.Second},
+			// Other hosts have buckets of their own.
+			{"b", 0, 0},
+			// By now the debt is paid off and the bucket full again.
+			{"a", 3 * time.Second, 0},
+			{"a", 3 * time.Second, 0},
+			{"a", 3 * time.Second, 500 * time.Millisecond},
+		}},
+		{"min delay", RateLimit{MinDelay: 100 * time.Millisecond}, []request{
+			{"a", 0, 0},
+			{"a", 0, 100 * time.Millisecond},
+			{"a", 50 * time.Millisecond, 150 * time.Millisecond},
+			{"a", time.Second, 0},
+		}},
+		{"rate and min delay", RateLimit{PerSecond: 1, MinDelay: 2 * time.Second}, []request{
+			{"a", 0, 0},
+			{"a", time.Second, time.Second},
+		}},
+	} {
+		th := NewThrottle(tt.limit)
+		start := time.Date(2013, 5, 1, 0, 0, 0, 0, time.UTC)
+		for i, r := range tt.reqs {
+			if got := th.reserve(r.host, start.Add(r.at)); got != r.want {
+				t.Errorf("%s: request %d to %s at %s: wait %s, want %s",
+					tt.name, i, r.host, r.at, got, r.want)
+			}
+		}
+	}
+}
+
+func TestThrottleSetLimit(t *testing.T) {
+	th := NewThrottle(RateLimit{PerSecond: 1})
+	th.SetLimit("slow", RateLimit{MinDelay: time.Minute})
+	if l := th.Limit("slow"); l.MinDelay != time.Minute || l.PerSecond != 0 {
+		t.Errorf("got limit %+v for slow", l)
+	}
+	if l := th.Limit("other"); l.PerSecond != 1 {
+		t.Errorf("got limit %+v for other", l)
+	}
+	now := time.Now()
+	th.reserve("slow", now)
+	if got := th.reserve("slow", now); got != time.Minute {
+		t.Errorf("second request to slow: wait %s, want 1m", got)
+	}
+}
+
+func TestThrottleWaitCancelled(t *testing.T) {
+	th := NewThrottle(RateLimit{MinDelay: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := th.Wait(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := th.Wait(ctx, "a"); err != context.Canceled {
+		t.Errorf("got %v waiting with a cancelled context, want context.Canceled", err)
+	}
+	var none *Throttle
+	if err := none.Wait(context.Background(), "a"); err != nil {
+		t.Errorf("nil Throttle: got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Default size at which a WARCWriter starts a new file.
+const DefaultWARCFileSize = 1 << 30
+
+// WARCWriter stores HTTP exchanges in WARC (ISO 28500) files. Every record
+// is compressed as a separate gzip member, so the files can be read by
+// standard web archive tools. Once a file grows beyond MaxSize, the writer
+// moves on to a new one. Files are written with an ".open" suffix that is
+// removed once they are complete. It is safe for concurrent use.
+type WARCWriter struct {
+	Dir     string
+	Prefix  string
+	MaxSize int64
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	serial  int
+}
+
+// NewWARCWriter returns a WARCWriter that creates files named
+// <prefix>-<timestamp>-<serial>.warc.gz in the given directory.
+func NewWARCWriter(dir, prefix string) (w *WARCWriter, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	w = &WARCWriter{Dir: dir, Prefix: prefix, MaxSize: DefaultWARCFileSize}
+	return
+}
+
+// WriteExchange appends a request record and the matching response record.
+// The response body is left intact for the caller.
+func (w *WARCWriter) WriteExchange(req *http.Request, rsp *http.Response) error {
+	reqBlock, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		return err
+	}
+	rspBlock, err := httputil.DumpResponse(rsp, true)
+	if err != nil {
+		return err
+	}
+	var (
+		url   = req.URL.String()
+		now   = time.Now()
+		rspID = warcRecordID()
+	)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.rotate(now); err != nil {
+		return err
+	}
+	err = w.writeRecord(now, []string{
+		"WARC-Type", "response",
+		"WARC-Record-ID", rspID,
+		"WARC-Target-URI", url,
+		"Content-Type", "application/http; msgtype=response",
+	}, rspBlock)
+	if err != nil {
+		return err
+	}
+	return w.writeRecord(now, []string{
+		"WARC-Type", "request",
+		"WARC-Record-ID", warcRecordID(),
+		"WARC-Concurrent-To", rspID,
+		"WARC-Target-URI", url,
+		"Content-Type", "application/http; msgtype=request",
+	}, reqBlock)
+}
+
+// Close finishes the current file.
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+// Opens a new file if there is none yet or the current one is full.
+func (w *WARCWriter) rotate(now time.Time) error {
+	if w.file != nil && w.size < w.MaxSize {
+		return nil
+	}
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.Prefix,
+		now.UTC().Format("20060102150405"), w.serial)
+	f, err := os.Create(filepath.Join(w.Dir, name+".open"))
+	if err != nil {
+		return err
+	}
+	w.file, w.size = f, 0
+	w.serial++
+	info := "software: scrapemonster\r\nformat: WARC File Format 1.0\r\n"
+	return w.writeRecord(now, []string{
+		"WARC-Type", "warcinfo",
+		"WARC-Record-ID", warcRecordID(),
+		"WARC-Filename", name,
+		"Content-Type", "application/warc-fields",
+	}, []byte(info))
+}
+
+func (w *WARCWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	f := w.file
+	w.file = nil
+	if err := f.Close(); err != nil {
+		return err
+	}
+	open := f.Name()
+	return os.Rename(open, open[:len(open)-len(".open")])
+}
+
+// Writes one gzip-compressed record. Headers are given as name/value pairs;
+// WARC-Date, WARC-Block-Digest and Content-Length are added automatically.
+func (w *WARCWriter) writeRecord(now time.Time, headers []string, block []byte) error {
+	var buf bytes.Buffer
+	digest := sha1.Sum(block)
+	buf.WriteString("WARC/1.0\r\n")
+	for i := 0; i+1 < len(headers); i += 2 {
+		fmt.Fprintf(&buf, "%s: %s\r\n", headers[i], headers[i+1])
+	}
+	fmt.Fprintf(&buf, "WARC-Date: %s\r\n", now.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&buf, "WARC-Block-Digest: sha1:%s\r\n",
+		base32.StdEncoding.EncodeToString(digest[:]))
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(block))
+	buf.Write(block)
+	buf.WriteString("\r\n\r\n")
+
+	cw := &countingWriter{Writer: w.file}
+	gz := gzip.NewWriter(cw)
+	if _, err := buf.WriteTo(gz); err != nil {
+		return err
+	}
+	err := gz.Close()
+	w.size += cw.n
+	return err
+}
+
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.Writer.Write(p)
+	cw.n += int64(n)
+	return
+}
+
+// Returns a random (version 4) UUID in the form WARC expects.
+func warcRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Copies every successful exchange to a WARCWriter.
+type warcTransport struct {
+	http.RoundTripper
+	warc *WARCWriter
+}
+
+func (t *warcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rsp, err := t.RoundTripper.RoundTrip(req)
+	if err == nil {
+		if werr := t.warc.WriteExchange(req, rsp); werr != nil {
+			log.Printf("crawler: warc: %s", werr)
+		}
+	}
+	return rsp, err
+}
+
+// WriteWARC makes the Getter store every response it receives, along with
+// the request, in WARC files.
+func (g *Getter) WriteWARC(w *WARCWriter) {
+	g.transport = &warcTransport{g.transport, w}
+}
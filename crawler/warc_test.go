@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWARCWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWARCWriter(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Start a new file for every exchange.
+	w.MaxSize = 1
+	g := NewTransportGetter(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/down" {
+			return nil, errors.New("connection refused")
+		}
+		return response(req, http.StatusOK, "body of "+req.URL.Path), nil
+	}))
+	g.MaxRetries = 0
+	g.MinBackoff, g.MaxBackoff = time.Millisecond, time.Millisecond
+	g.WriteWARC(w)
+	for _, url := range []string{"http://a/one", "http://a/down", "http://a/two"} {
+		g.GetBody(context.Background(), url)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	// Failed exchanges are not written.
+	if len(files) != 2 {
+		t.Fatalf("got files %q, want 2", files)
+	}
+	var bodies []string
+	for _, file := range files {
+		name := filepath.Base(file)
+		if !strings.HasPrefix(name, "test-") || !strings.HasSuffix(name, ".warc.gz") {
+			t.Errorf("bad file name %q", name)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			br    = bufio.NewReader(gz)
+			types []string
+			rspID string
+		)
+		for {
+			headers, block, err := readWARCRecord(br)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			types = append(types, headers["warc-type"])
+			digest := sha1.Sum(block)
+			if got, want := headers["warc-block-digest"], "sha1:"+base32.StdEncoding.EncodeToString(digest[:]); got != want {
+				t.Errorf("%s: got digest %q, want %q", name, got, want)
+			}
+			switch headers["warc-type"] {
+			case "warcinfo":
+				if headers["warc-filename"] != name {
+					t.Errorf("%s: warcinfo names %q", name, headers["warc-filename"])
+				}
+			case "response":
+				rspID = headers["warc-record-id"]
+			case "request":
+				if got := headers["warc-concurrent-to"]; got == "" || got != rspID {
+					t.Errorf("%s: request is concurrent to %q, want %q", name, got, rspID)
+				}
+			}
+		}
+		f.Close()
+		if got := strings.Join(types, ","); got != "warcinfo,response,request" {
+			t.Errorf("%s: got records %s", name, got)
+		}
+
+		err = ReadWARC(file, func(c *Capture) error {
+			bodies = append(bodies, c.URL.String()+" "+string(c.Body))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"http://a/one body of /one", "http://a/two body of /two"}
+	if strings.Join(bodies, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got captures %q, want %q", bodies, want)
+	}
+}
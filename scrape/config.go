@@ -0,0 +1,414 @@
+package scrape
+
+import (
+	"code.google.com/p/cascadia"
+	"code.google.com/p/go.net/html"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/launchtime/scrapemonster/crawler"
+	"github.com/launchtime/scrapemonster/scrape/htmlutil"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SiteConfig describes a site declaratively, as loaded from a JSON file.
+// A ConfigScraper built from it parses deal pages without any site-specific
+// Go code. For example:
+//
+//	{
+//	  "name": "example",
+//	  "host": "www.example.co.kr",
+//	  "start_url": "http://www.example.co.kr/home/",
+//	  "deal_url": "http://www.example.co.kr/deal/%d",
+//	  "deal_path": "^/deal/(\\d+)",
+//	  "list_paths": ["^/deallist/\\d+"],
+//	  "not_found": ".error_type .no_find",
+//	  "fields": {
+//	    "description": {"selector": "title"},
+//	    "discount_price": {"selector": ".price_info .price .now_price"},
+//	    "num_sold": {"regexp": "countUpTo\\((\\d+)\\)"},
+//	    "expired": {"selector": "a#buy_button", "regexp": "^판매종료$"}
+//	  }
+//	}
+type SiteConfig struct {
+	Name     string `json:"name"` // at most 10 bytes, the width of the site columns
+	Host     string `json:"host"`
+	StartURL string `json:"start_url"`
+
+	// Format of a deal's canonical URL, with %d standing for the deal ID.
+	DealURL string `json:"deal_url"`
+
+	// Regular expression for the path of deal pages; its first group is the
+	// deal ID.
+	DealPath string `json:"deal_path"`
+
+	// Regular expressions for the paths of deal list pages. The crawler
+	// follows links to them, with their query string and fragment removed.
+	ListPaths []string `json:"list_paths"`
+
+	// Regular expression for URLs to follow that are not plain links, such
+	// as those in scripts. Optional.
+	ExtractURLs string `json:"extract_urls"`
+
+	// Selector matching only on pages of deals that do not exist. Optional.
+	NotFound string `json:"not_found"`
+
+	// Extraction rules for the Deal fields, keyed by: description,
+	// category, subcategory, locale, original_price, discount_price,
+	// num_sold, expired and adult.
+	Fields map[string]*FieldConfig `json:"fields"`
+}
+
+// FieldConfig says how to extract one Deal field from a page.
+//
+// The value is taken from the nodes matching Selector: from attribute Attr
+// if given, otherwise from the node's first text child (or, with Text set to
+// "tree", from all text under it). Only the locale field uses every matching
+// node; the others need exactly one match. Without a selector, the value is
+// the whole page source, so a rule needs a selector, a regexp or both.
+//
+// If Regexp is given, the value is replaced by its first group (or the whole
+// match if it has no groups), and the field is empty when it does not match.
+// Finally, a value found in Map is replaced by the mapped value.
+//
+// Numeric fields drop every non-digit from the value. The boolean fields,
+// expired and adult, are true if a value was found at all.
+type FieldConfig struct {
+	Selector string            `json:"selector"`
+	Attr     string            `json:"attr"`
+	Text     string            `json:"text"`
+	Regexp   string            `json:"regexp"`
+	Map      map[string]string `json:"map"`
+
+	selector Selector
+	regexp   *regexp.Regexp
+}
+
+// The width of the site columns in the database.
+const maxSiteNameLength = 10
+
+var configFields = map[string]bool{
+	"description":    true,
+	"category":       true,
+	"subcategory":    true,
+	"locale":         true,
+	"original_price": true,
+	"discount_price": true,
+	"num_sold":       true,
+	"expired":        true,
+	"adult":          true,
+}
+
+// ConfigScraper is a Scraper defined by a SiteConfig. It does not scrape deal
+// options, since every site serves them in its own way.
+type ConfigScraper struct {
+	config      *SiteConfig
+	dealPath    *regexp.Regexp
+	listPaths   []*regexp.Regexp
+	extractURLs *regexp.Regexp
+	notFound    cascadia.Selector
+}
+
+// ParseSiteConfig decodes and validates a JSON site definition.
+func ParseSiteConfig(data []byte) (c *SiteConfig, err error) {
+	c = new(SiteConfig)
+	if err = json.Unmarshal(data, c); err != nil {
+		c = nil
+		return
+	}
+	switch {
+	case c.Name == "" || c.Host == "" || c.DealURL == "" || c.DealPath == "":
+		err = fmt.Errorf("scrape: site config needs name, host, deal_url and deal_path")
+	case len(c.Name) > maxSiteNameLength:
+		err = fmt.Errorf("scrape: site name %q is longer than %d bytes", c.Name, maxSiteNameLength)
+	case strings.Count(strings.Replace(c.DealURL, "%%", "", -1), "%") != 1 ||
+		!strings.Contains(c.DealURL, "%d"):
+		err = fmt.Errorf("scrape: %s: deal_url needs exactly one %%d and no other verbs", c.Name)
+	}
+	for name, f := range c.Fields {
+		if err == nil && f != nil && f.Selector == "" && f.Regexp == "" {
+			err = fmt.Errorf("scrape: %s: %s: rule needs a selector or a regexp", c.Name, name)
+		}
+	}
+	if err != nil {
+		c = nil
+	}
+	return
+}
+
+// NewConfigScraper compiles the selectors and regular expressions of a site
+// definition.
+func NewConfigScraper(c *SiteConfig) (s *ConfigScraper, err error) {
+	s = &ConfigScraper{config: c}
+	fail := func(what string, e error) {
+		err = fmt.Errorf("scrape: %s: %s: %s", c.Name, what, e)
+		s = nil
+	}
+	if s.dealPath, err = regexp.Compile(c.DealPath); err != nil {
+		fail("deal_path", err)
+		return
+	}
+	for _, p := range c.ListPaths {
+		re, e := regexp.Compile(p)
+		if e != nil {
+			fail("list_paths", e)
+			return
+		}
+		s.listPaths = append(s.listPaths, re)
+	}
+	if c.ExtractURLs != "" {
+		if s.extractURLs, err = regexp.Compile(c.ExtractURLs); err != nil {
+			fail("extract_urls", err)
+			return
+		}
+	}
+	if c.NotFound != "" {
+		if s.notFound, err = cascadia.Compile(c.NotFound); err != nil {
+			fail("not_found", err)
+			return
+		}
+	}
+	for name, f := range c.Fields {
+		if !configFields[name] {
+			fail("fields", fmt.Errorf("unknown field %q", name))
+			return
+		}
+		if f == nil {
+			fail(name, fmt.Errorf("no extraction rule"))
+			return
+		}
+		if f.Selector != "" {
+			if f.selector, err = CompileSelector(f.Selector); err != nil {
+				fail(name, err)
+				return
+			}
+		}
+		if f.Regexp != "" {
+			if f.regexp, err = regexp.Compile(f.Regexp); err != nil {
+				fail(name, err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// LoadSiteConfigs registers a ConfigScraper for every *.json file in the
+// given directory. Sites that are already registered are an error.
+func LoadSiteConfigs(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		c, err := ParseSiteConfig(data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		s, err := NewConfigScraper(c)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		if _, dup := Lookup(c.Name); dup {
+			return fmt.Errorf("%s: site %q is already defined", file, c.Name)
+		}
+		Register(c.Name, func() Scraper { return s })
+	}
+	return nil
+}
+
+func (s *ConfigScraper) Name() string {
+	return s.config.Name
+}
+
+func (s *ConfigScraper) DefaultStartURL() string {
+	if s.config.StartURL != "" {
+		return s.config.StartURL
+	}
+	return "http://" + s.config.Host + "/"
+}
+
+func (s *ConfigScraper) parseDealURL(u *url.URL) (id DealID, ok bool) {
+	if u == nil || u.Host != s.config.Host {
+		return
+	}
+	matches := s.dealPath.FindStringSubmatch(u.Path)
+	if len(matches) >= 2 {
+		if n, err := strconv.ParseInt(matches[1], 10, 64); err == nil {
+			id = DealID(n)
+			ok = true
+		}
+	}
+	return
+}
+
+func (s *ConfigScraper) TransformURL(u *url.URL) *url.URL {
+	if id, ok := s.parseDealURL(u); ok {
+		return s.DealURL(id)
+	}
+	if u == nil || u.Host != s.config.Host {
+		return nil
+	}
+	for _, re := range s.listPaths {
+		if re.MatchString(u.Path) {
+			return &url.URL{Scheme: "http", Host: u.Host, Path: u.Path}
+		}
+	}
+	return nil
+}
+
+func (s *ConfigScraper) DealURL(id DealID) *url.URL {
+	u, err := url.Parse(fmt.Sprintf(s.config.DealURL, id))
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+func (s *ConfigScraper) ExtractURLs(body string) (urls []*url.URL) {
+	if s.extractURLs == nil {
+		return
+	}
+	base := &url.URL{Scheme: "http", Host: s.config.Host, Path: "/"}
+	for _, m := range s.extractURLs.FindAllString(body, -1) {
+		if u, err := url.Parse(m); err == nil {
+			urls = append(urls, base.ResolveReference(u))
+		}
+	}
+	return
+}
+
+func (s *ConfigScraper) GetDealOptions(ctx context.Context, g *crawler.Getter, id DealID) []*Option {
+	return nil
+}
+
+func (s *ConfigScraper) ParseDeal(u *url.URL, body string) (d *Deal, err error) {
+	dealID, ok := s.parseDealURL(u)
+	if !ok {
+		return
+	}
+	root, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return
+	}
+	if s.notFound != nil && len(s.notFound.MatchAll(root)) != 0 {
+		return
+	}
+	var diag Diagnostics
+	str := func(name string) *string {
+		if vals := s.extract(name, root, body, &diag); len(vals) == 1 {
+			return &vals[0]
+		}
+		return nil
+	}
+	num := func(name string) *int {
+		if v := str(name); v != nil {
+			return diag.Integer(name, *v)
+		}
+		return nil
+	}
+	// Pages without the expired or adult markers are the norm, not a
+	// parse problem.
+	flag := func(name string) bool {
+		return len(s.extract(name, root, body, nil)) == 1
+	}
+	d = &Deal{
+		SiteName:      s.Name(),
+		DealID:        dealID,
+		Description:   str("description"),
+		Category:      str("category"),
+		Subcategory:   str("subcategory"),
+		Locale:        s.extract("locale", root, body, &diag),
+		OriginalPrice: num("original_price"),
+		DiscountPrice: num("discount_price"),
+		NumSold:       num("num_sold"),
+		Expired:       flag("expired"),
+		Adult:         flag("adult"),
+	}
+	// A field has one selector, so it is the one behind every problem.
+	for i := range diag {
+		if f := s.config.Fields[diag[i].Field]; f != nil && diag[i].Selector == "" {
+			diag[i].Selector = f.Selector
+		}
+	}
+	d.Diagnostics = diag
+	return
+}
+
+// Returns the values of the named field found in the page. Fields other than
+// locale yield at most one value. Problems are recorded in diag, unless it
+// is nil.
+func (s *ConfigScraper) extract(name string, root *html.Node, body string, diag *Diagnostics) (vals []string) {
+	if diag == nil {
+		diag = new(Diagnostics)
+	}
+	f := s.config.Fields[name]
+	if f == nil {
+		return
+	}
+	nproblems := len(*diag)
+	var raw []string
+	if f.selector.Selector == nil {
+		raw = []string{body}
+	} else {
+		var nodes []*html.Node
+		if name == "locale" {
+			nodes = diag.MatchAll(name, root, f.selector)
+		} else if n := diag.MatchOne(name, root, f.selector); n != nil {
+			nodes = []*html.Node{n}
+		}
+		for _, n := range nodes {
+			if v := f.nodeValue(n); v != nil {
+				raw = append(raw, *v)
+			}
+		}
+	}
+	for _, v := range raw {
+		if f.regexp != nil {
+			matches := f.regexp.FindStringSubmatch(v)
+			if matches == nil {
+				continue
+			}
+			v = matches[0]
+			if len(matches) > 1 {
+				v = matches[1]
+			}
+		}
+		if mapped, ok := f.Map[v]; ok {
+			v = mapped
+		}
+		if name == "locale" && v == "" {
+			continue
+		}
+		vals = append(vals, v)
+	}
+	if len(vals) == 0 && len(*diag) == nproblems {
+		diag.Add(name, Missing)
+	}
+	return
+}
+
+// Returns the raw value of the field in the given node.
+func (f *FieldConfig) nodeValue(n *html.Node) *string {
+	if f.Attr != "" {
+		if attr := htmlutil.GetAttr(n, f.Attr); attr != nil {
+			s := strings.TrimSpace(attr.Val)
+			return &s
+		}
+		return nil
+	}
+	if f.Text == "tree" {
+		s := strings.TrimSpace(htmlutil.TreeText(n))
+		return &s
+	}
+	return htmlutil.FirstText(n)
+}
@@ -0,0 +1,72 @@
+package scrape_test
+
+import (
+	"github.com/launchtime/scrapemonster/scrape"
+	"github.com/launchtime/scrapemonster/scrape/scrapetest"
+	"strings"
+	"testing"
+)
+
+func newExampleScraper(t *testing.T) *scrape.ConfigScraper {
+	c, err := scrape.ParseSiteConfig(scrapetest.Fixture(t, "example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := scrape.NewConfigScraper(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+var examplePages = []scrapetest.Page{
+	{URL: "http://www.example.co.kr/deal/100", File: "example-deal-100.html"},
+	{URL: "http://www.example.co.kr/deal/200", File: "example-deal-200.html"},
+	{URL: "http://www.example.co.kr/deal/404", File: "example-deal-404.html"},
+}
+
+func TestConfigScraperParseDeal(t *testing.T) {
+	scrapetest.ParseDeal(t, newExampleScraper(t), examplePages...)
+}
+
+func TestConfigScraperExtractURLs(t *testing.T) {
+	scrapetest.ExtractURLs(t, newExampleScraper(t), examplePages[0])
+}
+
+func TestConfigScraperTransformURL(t *testing.T) {
+	scrapetest.TransformURL(t, newExampleScraper(t), "example-transform.golden",
+		"http://www.example.co.kr/deal/100",
+		"http://www.example.co.kr/deal/100?src=list#review",
+		"http://www.example.co.kr/deallist/31?page=2",
+		"http://www.example.co.kr/mypage",
+		"http://www.example.com/deal/100",
+	)
+}
+
+func TestConfigScraperErrors(t *testing.T) {
+	for _, tt := range []struct {
+		config, want string
+	}{
+		{`{"name": "x", "host": "x"}`, "needs name, host, deal_url and deal_path"},
+		{`{"name": "example.co.kr", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+)"}`, "longer than 10 bytes"},
+		{`{"name": "x", "host": "x", "deal_url": "/deal", "deal_path": "(\\d+)"}`, "deal_url"},
+		{`{"name": "x", "host": "x", "deal_url": "/%d/%d", "deal_path": "(\\d+)"}`, "deal_url"},
+		{`{"name": "x", "host": "x", "deal_url": "/%s?id=%d", "deal_path": "(\\d+)"}`, "deal_url"},
+		{`{"name": "x", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+"}`, "deal_path"},
+		{`{"name": "x", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+)", "list_paths": ["["]}`, "list_paths"},
+		{`{"name": "x", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+)", "not_found": "[["}`, "not_found"},
+		{`{"name": "x", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+)", "fields": {"prise": {"selector": "p"}}}`, `unknown field "prise"`},
+		{`{"name": "x", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+)", "fields": {"num_sold": {"selector": "p:bogus"}}}`, "num_sold"},
+		{`{"name": "x", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+)", "fields": {"num_sold": {"regexp": "("}}}`, "num_sold"},
+		{`{"name": "x", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+)", "fields": {"discount_price": null}}`, "discount_price: no extraction rule"},
+		{`{"name": "x", "host": "x", "deal_url": "/%d", "deal_path": "(\\d+)", "fields": {"num_sold": {"map": {"a": "1"}}}}`, "num_sold: rule needs a selector or a regexp"},
+	} {
+		c, err := scrape.ParseSiteConfig([]byte(tt.config))
+		if err == nil {
+			_, err = scrape.NewConfigScraper(c)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tt.config, err, tt.want)
+		}
+	}
+}
@@ -1,16 +1,15 @@
 package coupang
 
 import (
-	"github.com/launchtime/scrapemonster/crawler"
 	"github.com/launchtime/scrapemonster/scrape"
 )
 
 type Scraper int
 
-func (_ *Scraper) Name() string {
-	return "coupang"
+func init() {
+	scrape.Register("coupang", func() scrape.Scraper { return new(Scraper) })
 }
 
-func (s *Scraper) GetDealOptions(g *crawler.Getter, id scrape.DealID) []*scrape.Option {
-	return nil
+func (_ *Scraper) Name() string {
+	return "coupang"
 }
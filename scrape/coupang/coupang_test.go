@@ -0,0 +1,42 @@
+package coupang
+
+import (
+	"github.com/launchtime/scrapemonster/scrape/scrapetest"
+	"testing"
+)
+
+var dealPages = []scrapetest.Page{
+	{URL: "http://www.coupang.com/deal.pang?coupang=23071425", File: "deal-23071425.html"},
+	{URL: "http://www.coupang.com/deal.pang?coupang=22904511", File: "deal-22904511.html"},
+	{URL: "http://www.coupang.com/deal.pang?coupang=22000001", File: "deal-invalid.html"},
+}
+
+func TestParseDeal(t *testing.T) {
+	scrapetest.ParseDeal(t, new(Scraper), dealPages...)
+}
+
+func TestExtractURLs(t *testing.T) {
+	scrapetest.ExtractURLs(t, new(Scraper), dealPages...)
+}
+
+func TestTransformURL(t *testing.T) {
+	scrapetest.TransformURL(t, new(Scraper), "transform.golden",
+		"http://www.coupang.com/deal.pang?coupang=23071425",
+		"http://www.coupang.com/deal.pang?coupang=23071431&src=related",
+		"http://www.coupang.com/alldeal.pang?tab=2",
+		"http://www.coupang.com/shopping.pang?subCategoryId=2",
+		"http://www.coupang.com/promotion/prmt.pang?promotionId=7710",
+		"http://www.coupang.com/login.pang",
+	)
+}
+
+// The option responses are written by hand after the endpoint's format, not
+// captured; replace them with captured ones when the endpoint is reachable.
+// The second color is sold out, but its sizes still count.
+func TestGetDealOptions(t *testing.T) {
+	scrapetest.DealOptions(t, new(Scraper), 23071425, "options.golden",
+		scrapetest.Page{URL: "http://www.coupang.com/dealOption.pang?coupang=23071425&depth=0", File: "options-depth0.json"},
+		scrapetest.Page{URL: "http://www.coupang.com/dealOption.pang?coupang=23071425&depth=1&optKey=1", File: "options-depth1-1.json"},
+		scrapetest.Page{URL: "http://www.coupang.com/dealOption.pang?coupang=23071425&depth=1&optKey=2", File: "options-depth1-2.json"},
+	)
+}
@@ -11,19 +11,19 @@ import (
 )
 
 var (
-	gnbCategorySelector = cascadia.MustCompile(`#gnbDepth1 > .on`)
+	gnbCategorySelector = scrape.MustCompileSelector(`#gnbDepth1 > .on`)
 
-	gnbSubcategorySelector = cascadia.MustCompile(`#gnbTopSubMenu > .on`)
+	gnbSubcategorySelector = scrape.MustCompileSelector(`#gnbTopSubMenu > .on`)
 
-	gnbLocaleSelector = cascadia.MustCompile(`#localCatePos .on`)
+	gnbLocaleSelector = scrape.MustCompileSelector(`#localCatePos .on`)
 
-	titleSelector = cascadia.MustCompile(`title`)
+	titleSelector = scrape.MustCompileSelector(`title`)
 
-	numSoldSelector = cascadia.MustCompile(`#buyCount`)
+	numSoldSelector = scrape.MustCompileSelector(`#buyCount`)
 
-	originalPriceSelector = cascadia.MustCompile(`.priceArea .originPrice .delPrice`)
+	originalPriceSelector = scrape.MustCompileSelector(`.priceArea .originPrice .delPrice`)
 
-	discountPriceSelector = cascadia.MustCompile(`.priceArea .salePrice`)
+	discountPriceSelector = scrape.MustCompileSelector(`.priceArea .salePrice`)
 
 	expiredBuyButtonSelector = cascadia.MustCompile(`#non_click_order_button`)
 
@@ -74,6 +74,7 @@ type dealPage struct {
 	dealID scrape.DealID
 	body   string
 	root   *html.Node
+	diag   scrape.Diagnostics
 }
 
 func newDealPage(id scrape.DealID, body string) (p *dealPage, err error) {
@@ -82,55 +83,49 @@ func newDealPage(id scrape.DealID, body string) (p *dealPage, err error) {
 	if err != nil {
 		return
 	}
-	p = &dealPage{id, body, root}
+	p = &dealPage{dealID: id, body: body, root: root}
 	return
 }
 
 func (p *dealPage) exists() bool {
-	if s := p.description(); s != nil {
-		return !strings.Contains(*s, "유효하지")
+	nodes := titleSelector.MatchAll(p.root)
+	if len(nodes) == 1 {
+		if s := htmlutil.FirstText(nodes[0]); s != nil {
+			return !strings.Contains(*s, "유효하지")
+		}
 	}
 	return false
 }
 
 func (p *dealPage) description() *string {
-	nodes := titleSelector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		return htmlutil.FirstText(nodes[0])
-	}
-	return nil
+	n := p.diag.MatchOne("description", p.root, titleSelector)
+	return p.diag.FirstText("description", n)
 }
 
 func (p *dealPage) category() *string {
-	nodes := gnbCategorySelector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		if attr := htmlutil.GetAttr(nodes[0], "id"); attr != nil {
-			if s, ok := catmap[attr.Val]; ok {
-				return &s
-			}
-			s := attr.Val
+	n := p.diag.MatchOne("category", p.root, gnbCategorySelector)
+	if id := p.diag.Attr("category", n, "id"); id != nil {
+		if s, ok := catmap[*id]; ok {
 			return &s
 		}
+		return id
 	}
 	return nil
 }
 
 func (p *dealPage) subcategory() *string {
-	nodes := gnbSubcategorySelector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		if attr := htmlutil.GetAttr(nodes[0], "id"); attr != nil {
-			if s, ok := subcatmap[attr.Val]; ok {
-				return &s
-			}
-			s := attr.Val
+	n := p.diag.MatchOne("subcategory", p.root, gnbSubcategorySelector)
+	if id := p.diag.Attr("subcategory", n, "id"); id != nil {
+		if s, ok := subcatmap[*id]; ok {
 			return &s
 		}
+		return id
 	}
 	return nil
 }
 
 func (p *dealPage) locale() []string {
-	nodes := gnbLocaleSelector.MatchAll(p.root)
+	nodes := p.diag.MatchAll("locale", p.root, gnbLocaleSelector)
 	if len(nodes) > 0 {
 		locale := make([]string, 0, len(nodes))
 		for _, n := range nodes {
@@ -144,15 +139,15 @@ func (p *dealPage) locale() []string {
 }
 
 func (p *dealPage) originalPrice() *int {
-	return htmlutil.ExtractInteger(p.root, originalPriceSelector)
+	return p.diag.ExtractInteger("original_price", p.root, originalPriceSelector)
 }
 
 func (p *dealPage) discountPrice() *int {
-	return htmlutil.ExtractInteger(p.root, discountPriceSelector)
+	return p.diag.ExtractInteger("discount_price", p.root, discountPriceSelector)
 }
 
 func (p *dealPage) numSold() *int {
-	return htmlutil.ExtractInteger(p.root, numSoldSelector)
+	return p.diag.ExtractInteger("num_sold", p.root, numSoldSelector)
 }
 
 func (p *dealPage) expired() bool {
@@ -190,5 +185,6 @@ func (s *Scraper) ParseDeal(u *url.URL, body string) (d *scrape.Deal, err error)
 		Expired:       p.expired(),
 		Adult:         p.adult(),
 	}
+	d.Diagnostics = p.diag
 	return
 }
@@ -0,0 +1,83 @@
+package coupang
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/launchtime/scrapemonster/crawler"
+	"github.com/launchtime/scrapemonster/scrape"
+	"log"
+)
+
+// The option endpoint returns one level of a deal's option tree as JSON.
+// Options that are not on the last level are expanded by requesting the
+// endpoint again with the option's key path (see scrape.WalkOptionTree).
+type optionList struct {
+	Options []*rawOption `json:"optionList"`
+}
+
+type rawOption struct {
+	OptionKey   string `json:"optionKey"`
+	OptionNo    int64  `json:"optionNo"`
+	OptionName  string `json:"optionName"`
+	SalePrice   int    `json:"salePrice"`
+	RemainCount int    `json:"remainCount"`
+	SoldCount   int    `json:"soldCount"`
+	SoldOut     bool   `json:"soldOut"`
+	LastDepth   bool   `json:"lastDepth"`
+}
+
+func (o *rawOption) node() *scrape.OptionNode {
+	return &scrape.OptionNode{
+		Key:     o.OptionKey,
+		Name:    o.OptionName,
+		Leaf:    o.LastDepth,
+		SoldOut: o.SoldOut,
+		Option: scrape.Option{
+			OptionID:     scrape.OptionID(o.OptionNo),
+			Price:        o.SalePrice,
+			NumAvailable: o.RemainCount,
+			NumSold:      o.SoldCount,
+		},
+	}
+}
+
+func unmarshalOptions(body []byte) (options []*rawOption, err error) {
+	var l optionList
+	if err = json.Unmarshal(body, &l); err == nil {
+		options = l.Options
+	}
+	return
+}
+
+func getOptions(ctx context.Context, g *crawler.Getter, dealID scrape.DealID, parent *scrape.OptionNode) (nodes []*scrape.OptionNode) {
+	var (
+		depth  int
+		optKey string
+	)
+	if parent != nil {
+		depth = parent.Depth + 1
+		optKey = parent.KeyPath()
+	}
+
+	url := urlForGetOptionList(dealID, depth, optKey).String()
+	body, err := g.GetBody(ctx, url)
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+
+	options, err := unmarshalOptions(body)
+	if err != nil {
+		log.Print(err.Error())
+	}
+	for _, o := range options {
+		nodes = append(nodes, o.node())
+	}
+	return
+}
+
+func (s *Scraper) GetDealOptions(ctx context.Context, g *crawler.Getter, id scrape.DealID) []*scrape.Option {
+	return scrape.WalkOptionTree(ctx, s.Name(), id, func(parent *scrape.OptionNode) []*scrape.OptionNode {
+		return getOptions(ctx, g, id, parent)
+	})
+}
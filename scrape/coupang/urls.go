@@ -22,6 +22,19 @@ func baseURL() *url.URL {
 	}
 }
 
+func urlForGetOptionList(id scrape.DealID, depth int, optKey string) *url.URL {
+	u := baseURL()
+	u.Path = "/dealOption.pang"
+	q := url.Values{}
+	q.Set("coupang", strconv.FormatInt(int64(id), 10))
+	q.Set("depth", strconv.Itoa(depth))
+	if optKey != "" {
+		q.Set("optKey", optKey)
+	}
+	u.RawQuery = q.Encode()
+	return u
+}
+
 func parseDealURL(u *url.URL) (id scrape.DealID, ok bool) {
 	if u.Path == "/deal.pang" {
 		q := u.Query()
@@ -0,0 +1,32 @@
+package scrape
+
+import (
+	"time"
+)
+
+// Snapshots are kept per day. A day is a calendar date in DayZone, Korean
+// time, where the sites' deals start and end; neither the time zone of the
+// database server nor that of the host running the commands matters. The
+// day is always worked out here and passed to the database, never left to
+// its CURRENT_DATE. Days are represented by midnight UTC of their date,
+// which is how the database drivers return dates.
+var DayZone = time.FixedZone("KST", 9*60*60)
+
+// Day returns the day that t falls on.
+func Day(t time.Time) time.Time {
+	t = t.In(DayZone)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ParseDay parses a day in yyyy-mm-dd format.
+func ParseDay(s string) (time.Time, error) {
+	return time.Parse("2006-01-02", s)
+}
+
+// DayTimes returns the span of time that a day covers: from its first
+// instant up to, but not including, the first instant of the next day.
+func DayTimes(day time.Time) (first, next time.Time) {
+	first = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, DayZone)
+	next = first.AddDate(0, 0, 1)
+	return
+}
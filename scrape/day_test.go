@@ -0,0 +1,26 @@
+package scrape
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDay(t *testing.T) {
+	for _, tt := range []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2013, 5, 1, 14, 59, 59, 0, time.UTC), "2013-05-01"},
+		{time.Date(2013, 5, 1, 15, 0, 0, 0, time.UTC), "2013-05-02"},
+		{time.Date(2013, 5, 2, 0, 30, 0, 0, DayZone), "2013-05-02"},
+		{time.Date(2013, 5, 1, 12, 0, 0, 0, time.FixedZone("PDT", -7*60*60)), "2013-05-02"},
+	} {
+		day := Day(tt.t)
+		if got := day.Format("2006-01-02"); got != tt.want {
+			t.Errorf("Day(%s) = %s, want %s", tt.t, got, tt.want)
+		}
+		if first, next := DayTimes(day); tt.t.Before(first) || !tt.t.Before(next) {
+			t.Errorf("DayTimes(%s) = %s, %s; want a span containing %s", tt.want, first, next, tt.t)
+		}
+	}
+}
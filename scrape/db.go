@@ -2,64 +2,146 @@ package scrape
 
 import (
 	"database/sql"
+	"fmt"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/ziutek/mymysql/godrv"
-	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
+// Store is where scraped deals and options are kept, one snapshot of each
+// per day (see Day), along with the intraday history of observations.
+type Store interface {
+	StoreDeal(d *Deal) error
+	StoreOption(o *Option) error
+	GetDealDailySnapshots(day time.Time) ([]*DealDailySnapshot, error)
+	GetOptionDailySnapshots(day time.Time) ([]*OptionDailySnapshot, error)
+	GetDealSnapshots(first, last time.Time) ([]*DealSnapshot, error)
+	GetOptionSnapshots(first, last time.Time) ([]*OptionSnapshot, error)
+	Close() error
+}
+
+// DB is a Store in a MySQL, PostgreSQL or SQLite database (see OpenDatabase).
+// Its schema is created by migrations (see MigrateUp). It is safe for
+// concurrent use, once its settings are made.
 type DB struct {
-	conn      *sql.DB
+	// If History is set, StoreDeal and StoreOption also append each
+	// observation to the intraday history (see AppendDeal).
+	History bool
+
+	// The statements that are run over and over are prepared once, unless
+	// NoPrepare is set. Connection poolers such as PgBouncer can lose
+	// prepared statements between transactions.
+	NoPrepare bool
+
+	conn    *sql.DB
+	dialect dialect
+
+	mu        sync.Mutex // guards stmtCache
 	stmtCache map[string]*sql.Stmt
 }
 
-func GetMySQLConnectionURI() string {
-	if uri := os.Getenv("MYSQL_CONNECTION_URI"); uri != "" {
-		return uri
-	}
-	return "scrapemonster//"
+// PoolConfig tunes a DB's connection pool. Zero values leave database/sql's
+// defaults.
+type PoolConfig struct {
+	MaxOpenConns    int           // max connections in use or idle
+	MaxIdleConns    int           // max idle connections
+	ConnMaxLifetime time.Duration // max time a connection is reused
+	ConnMaxIdleTime time.Duration // max time a connection stays idle
 }
 
+// OpenDatabase connects to the database at the given URI. The URI's scheme
+// selects the kind of database: "postgres://..." for PostgreSQL,
+// "sqlite:path" for SQLite, and "mysql:" followed by a mymysql data source
+// for MySQL. URIs without one of these schemes are taken to be MySQL data
+// sources, e.g. "scrapemonster//".
 func OpenDatabase(uri string) (db *DB, err error) {
+	d, driver, dsn := parseConnectionURI(uri)
 	var conn *sql.DB
-	conn, err = sql.Open("mymysql", uri)
-	if err == nil {
-		db = &DB{conn: conn, stmtCache: make(map[string]*sql.Stmt)}
+	conn, err = sql.Open(driver, dsn)
+	if err != nil {
+		return
 	}
+	if d == sqliteDialect {
+		// SQLite locks the whole file for writing.
+		conn.SetMaxOpenConns(1)
+	}
+	db = &DB{conn: conn, dialect: d, stmtCache: make(map[string]*sql.Stmt)}
 	return
 }
 
+// ConfigurePool applies the configuration to the connection pool. A SQLite
+// database keeps a single connection regardless.
+func (db *DB) ConfigurePool(c PoolConfig) {
+	if c.MaxOpenConns > 0 && db.dialect != sqliteDialect {
+		db.conn.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.conn.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.conn.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		db.conn.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+}
+
+// Close releases the prepared statements and closes the connections.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	for name, stmt := range db.stmtCache {
+		stmt.Close()
+		delete(db.stmtCache, name)
+	}
+	db.mu.Unlock()
+	return db.conn.Close()
+}
+
 func (db *DB) StoreDeal(d *Deal) (err error) {
-	var stmt *sql.Stmt
-	stmt, err = db.getCachedStmt("insertDealDailySnapshot", insertDealDailySnapshotSQL)
-	if err != nil {
-		return
+	now := time.Now()
+	err = db.StoreDealOn(d, Day(now))
+	if err == nil && db.History {
+		err = db.AppendDeal(d, now)
 	}
-	desc := trunc(d.Description, 500)
-	cat := trunc(d.Category, 100)
-	subcat := trunc(d.Subcategory, 100)
-	locale := truncjoin(d.Locale, 200)
-	_, err = stmt.Exec(d.SiteName, d.DealID,
-		desc, cat, subcat, locale, d.OriginalPrice,
-		d.DiscountPrice, d.NumSold, d.Expired, d.Adult,
-		desc, cat, subcat, locale, d.OriginalPrice,
-		d.DiscountPrice, d.NumSold, d.Expired, d.Adult)
 	return
 }
 
+// StoreDealOn is like StoreDeal, but stores the deal's snapshot for the given
+// day instead of today. It is used to rewrite history.
+func (db *DB) StoreDealOn(d *Deal, day time.Time) (err error) {
+	_, err = db.exec("insertDealDailySnapshot", insertDealDailySnapshotSQL, db.dealArgs(d, day)...)
+	return
+}
+
+// Returns the parameters of insertDealDailySnapshotSQL for the deal.
+func (db *DB) dealArgs(d *Deal, day time.Time) []interface{} {
+	return []interface{}{d.SiteName, d.DealID, db.dialect.day(day),
+		trunc(d.Description, 500), trunc(d.Category, 100),
+		trunc(d.Subcategory, 100), truncjoin(d.Locale, 200),
+		d.OriginalPrice, d.DiscountPrice, d.NumSold, d.Expired, d.Adult}
+}
+
 func (db *DB) StoreOption(o *Option) (err error) {
-	var stmt *sql.Stmt
-	stmt, err = db.getCachedStmt("insertOptionDailySnapshot", insertOptionDailySnapshotSQL)
-	if err != nil {
-		return
+	now := time.Now()
+	_, err = db.exec("insertOptionDailySnapshot", insertOptionDailySnapshotSQL,
+		db.optionArgs(o, Day(now))...)
+	if err == nil && db.History {
+		err = db.AppendOption(o, now)
 	}
-	desc := trunc(&o.Description, 500)
-	_, err = stmt.Exec(o.SiteName, o.DealID, o.OptionID,
-		desc, o.Price, o.NumAvailable, o.NumSold,
-		desc, o.Price, o.NumAvailable, o.NumSold)
 	return
 }
 
+// Returns the parameters of insertOptionDailySnapshotSQL for the option.
+func (db *DB) optionArgs(o *Option, day time.Time) []interface{} {
+	return []interface{}{o.SiteName, o.DealID, o.OptionID, db.dialect.day(day),
+		trunc(&o.Description, 500), o.Price, o.NumAvailable, o.NumSold}
+}
+
 type DealDailySnapshot struct {
 	Site          string
 	DealID        int64
@@ -77,7 +159,7 @@ type DealDailySnapshot struct {
 
 func (db *DB) GetDealDailySnapshots(day time.Time) (rs []*DealDailySnapshot, err error) {
 	var rows *sql.Rows
-	rows, err = db.conn.Query(selectDealDailySnapshotByDaySQL, day)
+	rows, err = db.query(selectDealDailySnapshotByDaySQL, db.dialect.day(day))
 	if err != nil {
 		return
 	}
@@ -95,6 +177,68 @@ func (db *DB) GetDealDailySnapshots(day time.Time) (rs []*DealDailySnapshot, err
 	return
 }
 
+// GetDealDailySnapshot returns the snapshot of one deal on the given day, or
+// nil if there is none.
+func (db *DB) GetDealDailySnapshot(site string, id DealID, day time.Time) (r *DealDailySnapshot, err error) {
+	var row DealDailySnapshot
+	err = db.conn.QueryRow(db.dialect.translate(selectDealDailySnapshotSQL),
+		site, id, db.dialect.day(day)).Scan(
+		&row.Site, &row.DealID, &row.Day, &row.Description,
+		&row.Category, &row.Subcategory, &row.Locale, &row.OriginalPrice,
+		&row.DiscountPrice, &row.NumSold, &row.IsExpired, &row.IsAdult)
+	if err == sql.ErrNoRows {
+		err = nil
+	} else if err == nil {
+		r = &row
+	}
+	return
+}
+
+// FieldChange describes how one field of a stored snapshot differs from a
+// freshly parsed Deal.
+type FieldChange struct {
+	Field    string
+	Old, New string
+}
+
+// Diff returns the fields that would change if the snapshot were overwritten
+// with the given deal. Values are compared the way StoreDeal stores them.
+func (r *DealDailySnapshot) Diff(d *Deal) (changes []FieldChange) {
+	cmp := func(field string, old, new interface{}) {
+		o, n := formatNullable(old), formatNullable(new)
+		if o != n {
+			changes = append(changes, FieldChange{field, o, n})
+		}
+	}
+	cmp("Description", r.Description, trunc(d.Description, 500))
+	cmp("Category", r.Category, trunc(d.Category, 100))
+	cmp("Subcategory", r.Subcategory, trunc(d.Subcategory, 100))
+	cmp("Locale", r.Locale, truncjoin(d.Locale, 200))
+	cmp("OriginalPrice", r.OriginalPrice, d.OriginalPrice)
+	cmp("DiscountPrice", r.DiscountPrice, d.DiscountPrice)
+	cmp("NumSold", r.NumSold, d.NumSold)
+	cmp("Expired", r.IsExpired, d.Expired)
+	cmp("Adult", r.IsAdult, d.Adult)
+	return
+}
+
+// Formats a nullable column value for display; NULL is shown as "NULL".
+func formatNullable(v interface{}) string {
+	switch t := v.(type) {
+	case *string:
+		if t != nil {
+			return *t
+		}
+	case *int:
+		if t != nil {
+			return strconv.Itoa(*t)
+		}
+	default:
+		return fmt.Sprint(t)
+	}
+	return "NULL"
+}
+
 type OptionDailySnapshot struct {
 	Site         string
 	DealID       int64
@@ -108,7 +252,7 @@ type OptionDailySnapshot struct {
 
 func (db *DB) GetOptionDailySnapshots(day time.Time) (rs []*OptionDailySnapshot, err error) {
 	var rows *sql.Rows
-	rows, err = db.conn.Query(selectOptionDailySnapshotByDaySQL, day)
+	rows, err = db.query(selectOptionDailySnapshotByDaySQL, db.dialect.day(day))
 	if err != nil {
 		return
 	}
@@ -126,10 +270,12 @@ func (db *DB) GetOptionDailySnapshots(day time.Time) (rs []*OptionDailySnapshot,
 }
 
 func (db *DB) getCachedStmt(name string, sql string) (stmt *sql.Stmt, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	if stmt = db.stmtCache[name]; stmt != nil {
 		return
 	}
-	stmt, err = db.conn.Prepare(sql)
+	stmt, err = db.conn.Prepare(db.dialect.translate(sql))
 	if err != nil {
 		return
 	}
@@ -137,12 +283,34 @@ func (db *DB) getCachedStmt(name string, sql string) (stmt *sql.Stmt, err error)
 	return
 }
 
+// Runs a statement written for MySQL, prepared under the given name unless
+// NoPrepare is set.
+func (db *DB) exec(name, sql string, args ...interface{}) (sql.Result, error) {
+	if db.NoPrepare {
+		return db.conn.Exec(db.dialect.translate(sql), args...)
+	}
+	stmt, err := db.getCachedStmt(name, sql)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+// Runs a query written for MySQL in the database's dialect.
+func (db *DB) query(sql string, args ...interface{}) (*sql.Rows, error) {
+	return db.conn.Query(db.dialect.translate(sql), args...)
+}
+
 func trunc(s *string, maxlen int) *string {
 	if s == nil {
 		return nil
 	}
 	t := strings.TrimSpace(*s)
 	if len(t) > maxlen {
+		// Cut at a character boundary; PostgreSQL rejects invalid UTF-8.
+		for maxlen > 0 && !utf8.RuneStart(t[maxlen]) {
+			maxlen--
+		}
 		t = t[:maxlen]
 	}
 	return &t
@@ -188,7 +356,7 @@ const insertDealDailySnapshotSQL = `
     VALUES (
         ?, /* site */
         ?, /* deal_id */
-        CURRENT_DATE(), /* day */
+        ?, /* day */
         ?, /* description */
         ?, /* category */
         ?, /* subcategory */
@@ -202,15 +370,15 @@ const insertDealDailySnapshotSQL = `
         NOW()) /* updated */
     ON DUPLICATE KEY UPDATE
         updated = NOW(),
-        description = ?,
-        category = ?,
-        subcategory = ?,
-        locale = ?,
-        original_price = ?,
-        discount_price = ?,
-        num_sold = ?,
-        expired = ?,
-        adult = ?`
+        description = VALUES(description),
+        category = VALUES(category),
+        subcategory = VALUES(subcategory),
+        locale = VALUES(locale),
+        original_price = VALUES(original_price),
+        discount_price = VALUES(discount_price),
+        num_sold = VALUES(num_sold),
+        expired = VALUES(expired),
+        adult = VALUES(adult)`
 
 const insertOptionDailySnapshotSQL = `
     INSERT IGNORE INTO option_daily_snapshot (
@@ -228,7 +396,7 @@ const insertOptionDailySnapshotSQL = `
         ?, /* site */
         ?, /* deal_id */
         ?, /* option_id */
-        CURRENT_DATE(), /* day */
+        ?, /* day */
         ?, /* description */
         ?, /* price */
         ?, /* num_available */
@@ -237,10 +405,16 @@ const insertOptionDailySnapshotSQL = `
         NOW()) /* updated */
     ON DUPLICATE KEY UPDATE
         updated = NOW(),
-        description = ?,
-        price = ?,
-        num_available = ?,
-        num_sold = ?`
+        description = VALUES(description),
+        price = VALUES(price),
+        num_available = VALUES(num_available),
+        num_sold = VALUES(num_sold)`
+
+const selectDealDailySnapshotSQL = `
+    SELECT site, deal_id, day, description, category, subcategory, locale,
+        original_price, discount_price, num_sold, expired, adult
+    FROM deal_daily_snapshot
+    WHERE site = ? AND deal_id = ? AND day = ?`
 
 const selectDealDailySnapshotByDaySQL = `
     SELECT site, deal_id, day, description, category, subcategory, locale,
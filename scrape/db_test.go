@@ -0,0 +1,165 @@
+package scrape
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a DB in a new SQLite file with the latest schema.
+func openTestDatabase(t *testing.T) *DB {
+	dir, err := ioutil.TempDir("", "scrape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	db, err := OpenDatabase("sqlite:" + filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.MigrateUp(-1); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func intp(i int) *int          { return &i }
+func stringp(s string) *string { return &s }
+
+func TestStoreSQLite(t *testing.T) {
+	db := openTestDatabase(t)
+	var _ Store = db
+
+	d := &Deal{
+		SiteName:      "tmon",
+		DealID:        14562681,
+		Description:   stringp("  " + strings.Repeat("가", 200)),
+		Category:      stringp("여행"),
+		Locale:        []string{"서울", " ", "부산"},
+		OriginalPrice: intp(30000),
+		DiscountPrice: intp(15000),
+		NumSold:       intp(10),
+	}
+	o := &Option{SiteName: "tmon", DealID: 14562681, OptionID: 7,
+		Description: "A|B", Price: 15000, NumAvailable: 5, NumSold: 3}
+	for i := 0; i < 2; i++ {
+		// The second time, the day's snapshots are updated in place.
+		if i == 1 {
+			d.NumSold = intp(12)
+			d.Expired = true
+			o.NumSold = 4
+		}
+		if err := db.StoreDeal(d); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.StoreOption(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	today := Day(time.Now())
+	deals, err := db.GetDealDailySnapshots(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 1 {
+		t.Fatalf("got %d deal snapshots, want 1", len(deals))
+	}
+	if changes := deals[0].Diff(d); changes != nil {
+		t.Errorf("stored deal differs: %v", changes)
+	}
+	if n := len(*deals[0].Description); n != 498 {
+		t.Errorf("description truncated to %d bytes, want 498", n)
+	}
+	if !deals[0].Day.Equal(today) {
+		t.Errorf("got day %s, want %s", deals[0].Day, today)
+	}
+
+	options, err := db.GetOptionDailySnapshots(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options) != 1 {
+		t.Fatalf("got %d option snapshots, want 1", len(options))
+	}
+	if r := options[0]; *r.Description != "A|B" || *r.NumSold != 4 || *r.NumAvailable != 5 {
+		t.Errorf("got option %+v", r)
+	}
+}
+
+func TestStoreSQLiteHistory(t *testing.T) {
+	db := openTestDatabase(t)
+	db.History = true
+
+	d := &Deal{SiteName: "wmp", DealID: 1123581, NumSold: intp(1)}
+	day := time.Date(2013, 5, 1, 0, 0, 0, 0, time.UTC)
+	for h := 0; h < 3; h++ {
+		d.NumSold = intp(10 * h)
+		if err := db.AppendDeal(d, day.Add(time.Duration(h)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AppendDeal(d, day.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.StoreDealOn(d, day); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateFillRates(day); err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := db.GetDealSnapshots(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 3 {
+		t.Fatalf("got %d observations, want 3", len(rs))
+	}
+	for h, r := range rs {
+		if want := day.Add(time.Duration(h) * time.Hour); !r.Captured.Equal(want) || *r.NumSold != 10*h {
+			t.Errorf("observation %d: got %s, %d sold; want %s, %d sold",
+				h, r.Captured, *r.NumSold, want, 10*h)
+		}
+	}
+
+	rates, err := db.GetFillRates(day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != len(FillRateFields) {
+		t.Fatalf("got %d fill rates, want %d", len(rates), len(FillRateFields))
+	}
+	for _, r := range rates {
+		filled := 0
+		if r.Field == "num_sold" {
+			filled = 1
+		}
+		if r.Deals != 1 || r.Filled != filled {
+			t.Errorf("%s: got %d of %d filled, want %d of 1", r.Field, r.Filled, r.Deals, filled)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	for _, tt := range []struct {
+		d        dialect
+		in, want string
+	}{
+		{mysqlDialect, insertOptionSnapshotSQL, insertOptionSnapshotSQL},
+		{postgresDialect,
+			"INSERT IGNORE INTO field_fill_rate (site, field) VALUES (?, '?') ON DUPLICATE KEY UPDATE field = VALUES(field), updated = NOW()",
+			"INSERT INTO field_fill_rate (site, field) VALUES ($1, '?') ON CONFLICT (site, day, field) DO UPDATE SET field = excluded.field, updated = CURRENT_TIMESTAMP"},
+		{sqliteDialect,
+			"SELECT * FROM deal_daily_snapshot WHERE day = CURRENT_DATE() AND site = ?",
+			"SELECT * FROM deal_daily_snapshot WHERE day = CURRENT_DATE AND site = ?"},
+	} {
+		if got := tt.d.translate(tt.in); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.d, got, tt.want)
+		}
+	}
+}
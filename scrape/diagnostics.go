@@ -0,0 +1,157 @@
+package scrape
+
+import (
+	"code.google.com/p/cascadia"
+	"code.google.com/p/go.net/html"
+	"github.com/launchtime/scrapemonster/scrape/htmlutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kinds of parse problems.
+const (
+	// The field's value was not found on the page.
+	Missing = "missing"
+
+	// The field's selector matched no nodes.
+	NoMatch = "no match"
+
+	// The field's selector matched more than one node.
+	MultipleMatches = "multiple matches"
+
+	// The field's text did not parse as an integer.
+	BadInteger = "bad integer"
+)
+
+// Diagnostic describes a problem found with one field while parsing a deal
+// page. A field that is simply empty on some pages (a locale on a shopping
+// deal, say) is reported just the same; it's the rate of problems per field
+// that tells a broken selector apart.
+type Diagnostic struct {
+	Field    string `json:"field"`
+	Kind     string `json:"kind"`
+	Selector string `json:"selector,omitempty"`
+	Matches  int    `json:"matches,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// Selector is a compiled CSS selector that keeps its source, so that the
+// diagnostics of a field can name the selector it was looked up with.
+type Selector struct {
+	cascadia.Selector
+	Source string
+}
+
+// CompileSelector is like cascadia.Compile.
+func CompileSelector(source string) (s Selector, err error) {
+	s.Source = source
+	s.Selector, err = cascadia.Compile(source)
+	return
+}
+
+// MustCompileSelector is like cascadia.MustCompile.
+func MustCompileSelector(source string) Selector {
+	return Selector{cascadia.MustCompile(source), source}
+}
+
+// Diagnostics collects the problems found while parsing one page. The helper
+// methods mirror those in package htmlutil, recording a Diagnostic whenever
+// they come up empty.
+type Diagnostics []Diagnostic
+
+// Add records a problem with the given field.
+func (d *Diagnostics) Add(field, kind string) {
+	*d = append(*d, Diagnostic{Field: field, Kind: kind})
+}
+
+// Returns the last recorded problem, so that callers can add details to it.
+func (d *Diagnostics) last() *Diagnostic {
+	return &(*d)[len(*d)-1]
+}
+
+// MatchOne returns the only node matching the selector, or nil if there is
+// not exactly one.
+func (d *Diagnostics) MatchOne(field string, root *html.Node, sel Selector) *html.Node {
+	nodes := sel.MatchAll(root)
+	switch len(nodes) {
+	case 1:
+		return nodes[0]
+	case 0:
+		d.Add(field, NoMatch)
+	default:
+		d.Add(field, MultipleMatches)
+		d.last().Matches = len(nodes)
+	}
+	d.last().Selector = sel.Source
+	return nil
+}
+
+// MatchAll returns the nodes matching the selector.
+func (d *Diagnostics) MatchAll(field string, root *html.Node, sel Selector) []*html.Node {
+	nodes := sel.MatchAll(root)
+	if len(nodes) == 0 {
+		d.Add(field, NoMatch)
+		d.last().Selector = sel.Source
+	}
+	return nodes
+}
+
+// FirstText is like htmlutil.FirstText, but n may be nil.
+func (d *Diagnostics) FirstText(field string, n *html.Node) *string {
+	if n == nil {
+		return nil
+	}
+	s := htmlutil.FirstText(n)
+	if s == nil {
+		d.Add(field, Missing)
+	}
+	return s
+}
+
+// Attr returns the value of the node's attribute. n may be nil.
+func (d *Diagnostics) Attr(field string, n *html.Node, key string) *string {
+	if n == nil {
+		return nil
+	}
+	if attr := htmlutil.GetAttr(n, key); attr != nil {
+		s := attr.Val
+		return &s
+	}
+	d.Add(field, Missing)
+	return nil
+}
+
+// Integer parses the digits in s as an integer.
+func (d *Diagnostics) Integer(field string, s string) *int {
+	if i, err := strconv.Atoi(htmlutil.RemoveNonDigits(s)); err == nil {
+		return &i
+	}
+	d.Add(field, BadInteger)
+	d.last().Text = truncate(strings.TrimSpace(s), 80)
+	return nil
+}
+
+// ExtractInteger is like htmlutil.ExtractInteger.
+func (d *Diagnostics) ExtractInteger(field string, root *html.Node, sel Selector) *int {
+	n := d.MatchOne(field, root, sel)
+	if n == nil {
+		return nil
+	}
+	i := d.Integer(field, htmlutil.TreeText(n))
+	if i == nil {
+		d.last().Selector = sel.Source
+	}
+	return i
+}
+
+// Returns s cut down to at most n bytes, on a character boundary.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
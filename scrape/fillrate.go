@@ -0,0 +1,95 @@
+package scrape
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// FillRateFields are the deal_daily_snapshot columns whose fill rates are
+// tracked. The expired and adult flags are always filled.
+var FillRateFields = []string{
+	"description",
+	"category",
+	"subcategory",
+	"locale",
+	"original_price",
+	"discount_price",
+	"num_sold",
+}
+
+// FillRate counts how many of a site's deals on one day had a field filled
+// in. A sudden drop usually means that a site redesign broke a selector.
+type FillRate struct {
+	Site   string
+	Day    time.Time
+	Field  string
+	Deals  int
+	Filled int
+}
+
+// Rate returns the share of deals with the field filled in, from 0 to 1.
+func (r *FillRate) Rate() float64 {
+	if r.Deals == 0 {
+		return 0
+	}
+	return float64(r.Filled) / float64(r.Deals)
+}
+
+// UpdateFillRates recomputes the fill rates of every site for the given day
+// from the deal snapshots stored for it.
+func (db *DB) UpdateFillRates(day time.Time) (err error) {
+	for _, field := range FillRateFields {
+		_, err = db.exec("updateFillRate:"+field,
+			fmt.Sprintf(updateFillRateSQL, field, field), db.dialect.day(day))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetFillRates returns the fill rates stored for the days from first to last,
+// inclusive.
+func (db *DB) GetFillRates(first, last time.Time) (rs []*FillRate, err error) {
+	var rows *sql.Rows
+	rows, err = db.query(selectFillRatesSQL,
+		db.dialect.day(first), db.dialect.day(last))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r FillRate
+		err = rows.Scan(&r.Site, &r.Day, &r.Field, &r.Deals, &r.Filled)
+		if err != nil {
+			return
+		}
+		rs = append(rs, &r)
+	}
+	err = rows.Err()
+	return
+}
+
+//
+// SQL statements
+//
+
+// The field name is substituted for both %s; COUNT(field) counts the rows
+// where it is not NULL.
+const updateFillRateSQL = `
+    INSERT INTO field_fill_rate (site, day, field, deals, filled, updated)
+    SELECT site, day, '%s', COUNT(*), COUNT(%s), NOW()
+    FROM deal_daily_snapshot
+    WHERE day = ?
+    GROUP BY site, day
+    ON DUPLICATE KEY UPDATE
+        deals = VALUES(deals),
+        filled = VALUES(filled),
+        updated = NOW()`
+
+const selectFillRatesSQL = `
+    SELECT site, day, field, deals, filled
+    FROM field_fill_rate
+    WHERE day BETWEEN ? AND ?
+    ORDER BY site, field, day`
@@ -0,0 +1,15 @@
+package groupon
+
+import (
+	"github.com/launchtime/scrapemonster/scrape"
+)
+
+type Scraper int
+
+func init() {
+	scrape.Register("groupon", func() scrape.Scraper { return new(Scraper) })
+}
+
+func (_ *Scraper) Name() string {
+	return "groupon"
+}
@@ -0,0 +1,45 @@
+package groupon
+
+import (
+	"github.com/launchtime/scrapemonster/scrape/scrapetest"
+	"testing"
+)
+
+var dealPages = []scrapetest.Page{
+	{URL: "http://www.groupon.kr/deal/1048576", File: "deal-1048576.html"},
+	{URL: "http://www.groupon.kr/deal/1048000", File: "deal-1048000.html"},
+}
+
+var listPage = scrapetest.Page{URL: "http://www.groupon.kr/category/shopping/4", File: "list-shopping-4.html"}
+
+func TestParseDeal(t *testing.T) {
+	scrapetest.ParseDeal(t, new(Scraper), append(dealPages, listPage)...)
+}
+
+func TestExtractURLs(t *testing.T) {
+	scrapetest.ExtractURLs(t, new(Scraper), dealPages[0], listPage)
+}
+
+func TestTransformURL(t *testing.T) {
+	scrapetest.TransformURL(t, new(Scraper), "transform.golden",
+		"http://www.groupon.kr/deal/1048576",
+		"http://www.groupon.kr/deal/1048576?src=main#buy",
+		"http://www.groupon.kr/category/shopping/4",
+		"http://www.groupon.kr/category/shopping/4?page=1",
+		"http://www.groupon.kr/category/shopping/4?sort=new&page=2",
+		"http://www.groupon.kr/local/seoul",
+		"http://www.groupon.kr/mypage",
+		"http://www.coupang.com/deal/1048576",
+	)
+}
+
+// The option responses are written by hand after the endpoint's format, not
+// captured; replace them with captured ones when the endpoint is reachable.
+// The third option is sold out, but its options' sales still count.
+func TestGetDealOptions(t *testing.T) {
+	scrapetest.DealOptions(t, new(Scraper), 1048576, "options.golden",
+		scrapetest.Page{URL: "http://www.groupon.kr/deal/option/1048576?depth=0", File: "options-depth0.json"},
+		scrapetest.Page{URL: "http://www.groupon.kr/deal/option/1048576?depth=1&optKey=101", File: "options-depth1-101.json"},
+		scrapetest.Page{URL: "http://www.groupon.kr/deal/option/1048576?depth=1&optKey=103", File: "options-depth1-103.json"},
+	)
+}
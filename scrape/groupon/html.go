@@ -0,0 +1,149 @@
+package groupon
+
+import (
+	"code.google.com/p/cascadia"
+	"code.google.com/p/go.net/html"
+	"github.com/launchtime/scrapemonster/scrape"
+	"github.com/launchtime/scrapemonster/scrape/htmlutil"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	titleSelector = scrape.MustCompileSelector(`meta[property="og:title"]`)
+
+	gnbCategorySelector = scrape.MustCompileSelector(`#gnb ul.menu > li.on > a`)
+
+	gnbSubcategorySelector = scrape.MustCompileSelector(`#lnb ul.submenu > li.on > a`)
+
+	gnbLocaleSelector = scrape.MustCompileSelector(`#localNav li.on > a`)
+
+	numSoldSelector = scrape.MustCompileSelector(`.deal_info .sold_count em`)
+
+	originalPriceSelector = scrape.MustCompileSelector(`.deal_info .price .original`)
+
+	discountPriceSelector = scrape.MustCompileSelector(`.deal_info .price .sale`)
+
+	buyButtonSelector = cascadia.MustCompile(`.deal_info .btn_area .btn_buy`)
+
+	expiredButtonRegexp = regexp.MustCompile(`판매\s*(?:종료|마감)|매진`)
+
+	adultWarningSelector = cascadia.MustCompile(`#adultCheck`)
+
+	adultWarningRegexp = regexp.MustCompile(`청소년보호법`)
+
+	notFoundErrorSelector = cascadia.MustCompile(`.error_page .no_deal`)
+)
+
+type dealPage struct {
+	body string
+	root *html.Node
+	diag scrape.Diagnostics
+}
+
+func newDealPage(body string) (p *dealPage, err error) {
+	var root *html.Node
+	root, err = html.Parse(strings.NewReader(body))
+	if err != nil {
+		return
+	}
+	p = &dealPage{body: body, root: root}
+	return
+}
+
+func (p *dealPage) exists() bool {
+	return len(notFoundErrorSelector.MatchAll(p.root)) == 0
+}
+
+func (p *dealPage) description() *string {
+	n := p.diag.MatchOne("description", p.root, titleSelector)
+	if s := p.diag.Attr("description", n, "content"); s != nil {
+		*s = strings.TrimSpace(*s)
+		return s
+	}
+	return nil
+}
+
+func (p *dealPage) category() *string {
+	n := p.diag.MatchOne("category", p.root, gnbCategorySelector)
+	return p.diag.FirstText("category", n)
+}
+
+func (p *dealPage) subcategory() *string {
+	n := p.diag.MatchOne("subcategory", p.root, gnbSubcategorySelector)
+	return p.diag.FirstText("subcategory", n)
+}
+
+func (p *dealPage) locale() []string {
+	nodes := p.diag.MatchAll("locale", p.root, gnbLocaleSelector)
+	if len(nodes) > 0 {
+		locale := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			if s := htmlutil.FirstText(n); s != nil && *s != "" {
+				locale = append(locale, *s)
+			}
+		}
+		return locale
+	}
+	return nil
+}
+
+func (p *dealPage) originalPrice() *int {
+	return p.diag.ExtractInteger("original_price", p.root, originalPriceSelector)
+}
+
+func (p *dealPage) discountPrice() *int {
+	return p.diag.ExtractInteger("discount_price", p.root, discountPriceSelector)
+}
+
+func (p *dealPage) numSold() *int {
+	return p.diag.ExtractInteger("num_sold", p.root, numSoldSelector)
+}
+
+func (p *dealPage) expired() bool {
+	nodes := buyButtonSelector.MatchAll(p.root)
+	if len(nodes) == 1 {
+		if attr := htmlutil.GetAttr(nodes[0], "class"); attr != nil &&
+			strings.Contains(attr.Val, "soldout") {
+			return true
+		}
+		s := htmlutil.FirstText(nodes[0])
+		return s != nil && expiredButtonRegexp.MatchString(*s)
+	}
+	return false
+}
+
+func (p *dealPage) adult() bool {
+	return len(adultWarningSelector.MatchAll(p.root)) >= 1 &&
+		adultWarningRegexp.FindStringSubmatch(p.body) != nil
+}
+
+func (s *Scraper) ParseDeal(u *url.URL, body string) (d *scrape.Deal, err error) {
+	dealID, ok := parseDealURL(u)
+	if !ok {
+		return
+	}
+	p, err := newDealPage(body)
+	if err != nil {
+		return
+	}
+	if !p.exists() {
+		return
+	}
+	d = &scrape.Deal{
+		SiteName:      s.Name(),
+		DealID:        dealID,
+		Description:   p.description(),
+		Category:      p.category(),
+		Subcategory:   p.subcategory(),
+		Locale:        p.locale(),
+		OriginalPrice: p.originalPrice(),
+		DiscountPrice: p.discountPrice(),
+		NumSold:       p.numSold(),
+		Expired:       p.expired(),
+		Adult:         p.adult(),
+	}
+	d.Diagnostics = p.diag
+	return
+}
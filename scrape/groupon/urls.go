@@ -0,0 +1,115 @@
+package groupon
+
+import (
+	"fmt"
+	"github.com/launchtime/scrapemonster/scrape"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+const HOST = "www.groupon.kr"
+
+var (
+	dealListPathRegexp = regexp.MustCompile(`^/((?:category|local)/\w+(?:/\d+)?)`)
+	dealPathRegexp     = regexp.MustCompile(`^/deal/(\d+)`)
+
+	// Quoted site URLs, in attributes and scripts alike. The query string
+	// is kept for the page numbers of the deal lists.
+	extractURLRegexp = regexp.MustCompile(`["']((?:https?://www\.groupon\.kr)?/(?:category|local|deal)/[-\w./]+(?:\?[-\w=&;%]+)?)`)
+)
+
+type dealListID string
+
+func baseURL() *url.URL {
+	return &url.URL{
+		Scheme: "http",
+		Host:   HOST,
+		Path:   "/",
+	}
+}
+
+// Returns the URL of a page of a deal list. Pages are numbered from 1.
+func urlForDealList(id dealListID, page int) *url.URL {
+	u := baseURL()
+	u.Path = fmt.Sprintf("/%s", id)
+	if page > 1 {
+		q := url.Values{}
+		q.Set("page", strconv.Itoa(page))
+		u.RawQuery = q.Encode()
+	}
+	return u
+}
+
+func urlForGetOptionList(id scrape.DealID, depth int, optKey string) *url.URL {
+	u := baseURL()
+	u.Path = fmt.Sprintf("/deal/option/%d", id)
+	q := url.Values{}
+	q.Set("depth", strconv.Itoa(depth))
+	if optKey != "" {
+		q.Set("optKey", optKey)
+	}
+	u.RawQuery = q.Encode()
+	return u
+}
+
+func parseDealListURL(u *url.URL) (id dealListID, page int, ok bool) {
+	matches := matchURL(u, dealListPathRegexp)
+	if matches != nil {
+		id = dealListID(matches[1])
+		page, _ = strconv.Atoi(u.Query().Get("page"))
+		ok = true
+	}
+	return
+}
+
+func parseDealURL(u *url.URL) (id scrape.DealID, ok bool) {
+	matches := matchURL(u, dealPathRegexp)
+	if matches != nil {
+		if n, err := strconv.ParseInt(matches[1], 10, 64); err == nil {
+			id = scrape.DealID(n)
+			ok = true
+		}
+	}
+	return
+}
+
+func matchURL(u *url.URL, re *regexp.Regexp) []string {
+	if u != nil && u.Host == HOST {
+		return re.FindStringSubmatch(u.Path)
+	}
+	return nil
+}
+
+func (_ *Scraper) DefaultStartURL() string {
+	return baseURL().String()
+}
+
+func (s *Scraper) TransformURL(u *url.URL) *url.URL {
+	if id, page, ok := parseDealListURL(u); ok {
+		return urlForDealList(id, page)
+	}
+	if id, ok := parseDealURL(u); ok {
+		return s.DealURL(id)
+	}
+	return nil
+}
+
+func (_ *Scraper) DealURL(id scrape.DealID) *url.URL {
+	u := baseURL()
+	u.Path = fmt.Sprintf("/deal/%d", id)
+	return u
+}
+
+// The deal lists link to deals from scripts as well as anchors, so the
+// crawler is given every site URL that appears in a page.
+func (_ *Scraper) ExtractURLs(body string) (urls []*url.URL) {
+	base := baseURL()
+	for _, m := range extractURLRegexp.FindAllStringSubmatch(body, -1) {
+		if u, err := url.Parse(html.UnescapeString(m[1])); err == nil {
+			urls = append(urls, base.ResolveReference(u))
+		}
+	}
+	return
+}
@@ -0,0 +1,169 @@
+package scrape
+
+import (
+	"database/sql"
+	"time"
+)
+
+// The daily snapshot tables keep only the last observation of each day. In
+// history mode (see DB.History), every observation is also appended to the
+// deal_snapshot and option_snapshot tables along with the time it was made,
+// so that sales can be followed through the day. Only the fields that
+// change during a deal's life are kept there; the descriptive ones stay in
+// the daily snapshots.
+
+// DealSnapshot is one observation of a deal.
+type DealSnapshot struct {
+	Site          string
+	DealID        int64
+	Captured      time.Time
+	OriginalPrice *int
+	DiscountPrice *int
+	NumSold       *int
+	IsExpired     bool
+}
+
+// OptionSnapshot is one observation of a deal option.
+type OptionSnapshot struct {
+	Site         string
+	DealID       int64
+	OptionID     int64
+	Captured     time.Time
+	Price        *int
+	NumAvailable *int
+	NumSold      *int
+}
+
+// AppendDeal records an observation of the deal made at the given time. An
+// observation made at the same time (to the second) is replaced.
+func (db *DB) AppendDeal(d *Deal, captured time.Time) (err error) {
+	_, err = db.exec("insertDealSnapshot", insertDealSnapshotSQL,
+		db.dealSnapshotArgs(d, captured)...)
+	return
+}
+
+// Returns the parameters of insertDealSnapshotSQL.
+func (db *DB) dealSnapshotArgs(d *Deal, captured time.Time) []interface{} {
+	return []interface{}{d.SiteName, d.DealID, db.dialect.timestamp(captured),
+		d.OriginalPrice, d.DiscountPrice, d.NumSold, d.Expired}
+}
+
+// AppendOption records an observation of the option made at the given time.
+func (db *DB) AppendOption(o *Option, captured time.Time) (err error) {
+	_, err = db.exec("insertOptionSnapshot", insertOptionSnapshotSQL,
+		db.optionSnapshotArgs(o, captured)...)
+	return
+}
+
+// Returns the parameters of insertOptionSnapshotSQL.
+func (db *DB) optionSnapshotArgs(o *Option, captured time.Time) []interface{} {
+	return []interface{}{o.SiteName, o.DealID, o.OptionID,
+		db.dialect.timestamp(captured), o.Price, o.NumAvailable, o.NumSold}
+}
+
+// GetDealSnapshots returns the deal observations made from first up to, but
+// not including, last, in the order they were made.
+func (db *DB) GetDealSnapshots(first, last time.Time) (rs []*DealSnapshot, err error) {
+	var rows *sql.Rows
+	rows, err = db.query(selectDealSnapshotsSQL,
+		db.dialect.timestamp(first), db.dialect.timestamp(last))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r DealSnapshot
+		err = rows.Scan(&r.Site, &r.DealID, &r.Captured, &r.OriginalPrice,
+			&r.DiscountPrice, &r.NumSold, &r.IsExpired)
+		if err != nil {
+			return
+		}
+		rs = append(rs, &r)
+	}
+	err = rows.Err()
+	return
+}
+
+// GetOptionSnapshots is like GetDealSnapshots, for options.
+func (db *DB) GetOptionSnapshots(first, last time.Time) (rs []*OptionSnapshot, err error) {
+	var rows *sql.Rows
+	rows, err = db.query(selectOptionSnapshotsSQL,
+		db.dialect.timestamp(first), db.dialect.timestamp(last))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r OptionSnapshot
+		err = rows.Scan(&r.Site, &r.DealID, &r.OptionID, &r.Captured,
+			&r.Price, &r.NumAvailable, &r.NumSold)
+		if err != nil {
+			return
+		}
+		rs = append(rs, &r)
+	}
+	err = rows.Err()
+	return
+}
+
+//
+// SQL statements
+//
+
+const insertDealSnapshotSQL = `
+    INSERT INTO deal_snapshot (
+        site,
+        deal_id,
+        captured,
+        original_price,
+        discount_price,
+        num_sold,
+        expired)
+    VALUES (
+        ?, /* site */
+        ?, /* deal_id */
+        ?, /* captured */
+        ?, /* original_price */
+        ?, /* discount_price */
+        ?, /* num_sold */
+        ?) /* expired */
+    ON DUPLICATE KEY UPDATE
+        original_price = VALUES(original_price),
+        discount_price = VALUES(discount_price),
+        num_sold = VALUES(num_sold),
+        expired = VALUES(expired)`
+
+const insertOptionSnapshotSQL = `
+    INSERT INTO option_snapshot (
+        site,
+        deal_id,
+        option_id,
+        captured,
+        price,
+        num_available,
+        num_sold)
+    VALUES (
+        ?, /* site */
+        ?, /* deal_id */
+        ?, /* option_id */
+        ?, /* captured */
+        ?, /* price */
+        ?, /* num_available */
+        ?) /* num_sold */
+    ON DUPLICATE KEY UPDATE
+        price = VALUES(price),
+        num_available = VALUES(num_available),
+        num_sold = VALUES(num_sold)`
+
+const selectDealSnapshotsSQL = `
+    SELECT site, deal_id, captured, original_price, discount_price,
+        num_sold, expired
+    FROM deal_snapshot
+    WHERE captured >= ? AND captured < ?
+    ORDER BY captured, site, deal_id`
+
+const selectOptionSnapshotsSQL = `
+    SELECT site, deal_id, option_id, captured, price, num_available, num_sold
+    FROM option_snapshot
+    WHERE captured >= ? AND captured < ?
+    ORDER BY captured, site, deal_id, option_id`
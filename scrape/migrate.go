@@ -0,0 +1,329 @@
+package scrape
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The schema is created and changed by migrations: numbered SQL scripts in
+// migrations/<dialect>, embedded in the programs. Each migration has an up
+// script that makes a change and a down script that reverts it. The
+// migrations applied to a database are recorded in its schema_version table
+// along with the checksums of their up scripts, so that a migration edited
+// after it was applied is noticed instead of silently diverging.
+//
+// To change the schema, add a new migration for every dialect; never edit
+// one that has been applied to a production database.
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one step in the evolution of the schema.
+type Migration struct {
+	Version  int
+	Name     string
+	Up, Down string
+}
+
+// Checksum returns the SHA-256 hash of the migration's up script, in hex.
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Returns the migrations of the dialect, in order. Versions start at 1 and
+// have no gaps.
+func loadMigrations(d dialect) (ms []*Migration, err error) {
+	dir := path.Join("migrations", string(d))
+	var entries []fs.DirEntry
+	if entries, err = migrationFiles.ReadDir(dir); err != nil {
+		return
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		file := path.Join(dir, e.Name())
+		m := migrationFileRegexp.FindStringSubmatch(e.Name())
+		if m == nil {
+			err = fmt.Errorf("%s: not a migration script", file)
+			return
+		}
+		version, _ := strconv.Atoi(m[1])
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+			ms = append(ms, mig)
+		} else if mig.Name != m[2] {
+			err = fmt.Errorf("%s: migration %d is also named %s", file, version, mig.Name)
+			return
+		}
+		var data []byte
+		if data, err = migrationFiles.ReadFile(file); err != nil {
+			return
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	for i, mig := range ms {
+		switch {
+		case mig.Version != i+1:
+			err = fmt.Errorf("%s: migration %d is missing", dir, i+1)
+		case mig.Up == "" || mig.Down == "":
+			err = fmt.Errorf("%s: migration %d (%s) needs both an up and a down script",
+				dir, mig.Version, mig.Name)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MigrationStatus tells whether a migration was applied to a database.
+type MigrationStatus struct {
+	Version int
+	Name    string
+
+	// The migration, or nil if it was applied to the database by a newer
+	// version of the program.
+	Migration *Migration
+
+	// When the migration was applied, or nil if it was not.
+	Applied *time.Time
+
+	// Whether the migration's up script differs from the one applied.
+	Modified bool
+}
+
+// MigrationStatus returns the status of every migration, in order. Migrations
+// that were applied to the database but are unknown to the program come last.
+// It does not change the database: if it has no schema_version table yet,
+// every migration is pending.
+func (db *DB) MigrationStatus() (ss []*MigrationStatus, err error) {
+	var ms []*Migration
+	if ms, err = loadMigrations(db.dialect); err != nil {
+		return
+	}
+	for _, m := range ms {
+		ss = append(ss, &MigrationStatus{Version: m.Version, Name: m.Name, Migration: m})
+	}
+	var n int
+	if err = db.conn.QueryRow(schemaVersionExistsSQL[db.dialect]).Scan(&n); err != nil || n == 0 {
+		return
+	}
+	var rows *sql.Rows
+	if rows, err = db.query(selectSchemaVersionSQL); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			s        MigrationStatus
+			checksum string
+			applied  time.Time
+		)
+		if err = rows.Scan(&s.Version, &s.Name, &checksum, &applied); err != nil {
+			return
+		}
+		if s.Version <= len(ms) {
+			m := ms[s.Version-1]
+			ss[s.Version-1].Applied = &applied
+			ss[s.Version-1].Modified = checksum != m.Checksum()
+		} else {
+			s.Applied = &applied
+			ss = append(ss, &s)
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// SchemaVersion returns the version of the last migration applied to the
+// database, or 0 if none was.
+func (db *DB) SchemaVersion() (version int, err error) {
+	var ss []*MigrationStatus
+	if ss, err = db.MigrationStatus(); err != nil {
+		return
+	}
+	for _, s := range ss {
+		if s.Applied != nil {
+			version = s.Version
+		}
+	}
+	return
+}
+
+// MigrateUp applies the migrations after the database's version, up to and
+// including the given version, or all of them if it is negative. It refuses
+// to if an applied migration was modified or is unknown, or if the applied
+// migrations have gaps. It returns the migrations that it applied.
+func (db *DB) MigrateUp(to int) (applied []*Migration, err error) {
+	var ss []*MigrationStatus
+	if ss, err = db.migrationStatusForUpdate(); err != nil {
+		return
+	}
+	pending := false
+	for _, s := range ss {
+		switch {
+		case s.Migration == nil:
+			err = fmt.Errorf("migration %d (%s) was applied by a newer program", s.Version, s.Name)
+		case s.Modified:
+			err = fmt.Errorf("migration %d (%s) was modified after it was applied", s.Version, s.Name)
+		case s.Applied != nil && pending:
+			err = fmt.Errorf("migration %d (%s) was applied, but an earlier one was not", s.Version, s.Name)
+		case s.Applied == nil:
+			pending = true
+		}
+		if err != nil {
+			return
+		}
+	}
+	for _, s := range ss {
+		if s.Applied != nil || (to >= 0 && s.Version > to) {
+			continue
+		}
+		m := s.Migration
+		err = db.runMigration(m, m.Up, insertSchemaVersionSQL, m.Version, m.Name, m.Checksum())
+		if err != nil {
+			return
+		}
+		applied = append(applied, m)
+	}
+	return
+}
+
+// MigrateDown reverts the applied migrations after the given version, most
+// recent first. It returns the migrations that it reverted.
+func (db *DB) MigrateDown(to int) (reverted []*Migration, err error) {
+	var ss []*MigrationStatus
+	if ss, err = db.migrationStatusForUpdate(); err != nil {
+		return
+	}
+	for i := len(ss) - 1; i >= 0 && ss[i].Version > to; i-- {
+		s := ss[i]
+		if s.Applied == nil {
+			continue
+		}
+		m := s.Migration
+		if m == nil {
+			err = fmt.Errorf("migration %d (%s) was applied by a newer program", s.Version, s.Name)
+			return
+		}
+		if err = db.runMigration(m, m.Down, deleteSchemaVersionSQL, m.Version); err != nil {
+			return
+		}
+		reverted = append(reverted, m)
+	}
+	return
+}
+
+// Returns the status of every migration, like MigrationStatus, after creating
+// the schema_version table if the database does not have one yet.
+func (db *DB) migrationStatusForUpdate() (ss []*MigrationStatus, err error) {
+	if _, err = db.conn.Exec(fmt.Sprintf(createSchemaVersionSQL, timestampTypes[db.dialect])); err != nil {
+		return
+	}
+	ss, err = db.MigrationStatus()
+	return
+}
+
+// Runs a migration's script and the statement that records it in
+// schema_version, in one transaction. Note that MySQL commits implicitly
+// after each schema change, so there a failed script can leave the schema
+// half-changed.
+func (db *DB) runMigration(m *Migration, script, record string, args ...interface{}) (err error) {
+	var tx *sql.Tx
+	if tx, err = db.conn.Begin(); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	for _, stmt := range splitStatements(script) {
+		if _, err = tx.Exec(stmt); err != nil {
+			err = fmt.Errorf("migration %d (%s): %s", m.Version, m.Name, err)
+			return
+		}
+	}
+	if _, err = tx.Exec(db.dialect.translate(record), args...); err != nil {
+		return
+	}
+	err = tx.Commit()
+	return
+}
+
+// Splits a script into statements at semicolons, leaving out those that are
+// empty or only comments.
+func splitStatements(script string) (stmts []string) {
+	for _, stmt := range strings.Split(script, ";") {
+		for _, line := range strings.Split(stmt, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "--") {
+				stmts = append(stmts, strings.TrimSpace(stmt))
+				break
+			}
+		}
+	}
+	return
+}
+
+//
+// SQL statements
+//
+
+var timestampTypes = map[dialect]string{
+	mysqlDialect:    "datetime",
+	postgresDialect: "timestamp",
+	sqliteDialect:   "datetime",
+}
+
+// The type of the applied column is substituted for %s.
+const createSchemaVersionSQL = `
+    CREATE TABLE IF NOT EXISTS schema_version (
+        version int PRIMARY KEY,
+        name varchar(100) NOT NULL,
+        checksum char(64) NOT NULL,
+        applied %s NOT NULL)`
+
+// Count the schema_version tables (0 or 1) visible to the connection.
+var schemaVersionExistsSQL = map[dialect]string{
+	mysqlDialect: `
+    SELECT COUNT(*) FROM information_schema.tables
+    WHERE table_schema = DATABASE() AND table_name = 'schema_version'`,
+	postgresDialect: `
+    SELECT COUNT(*) FROM information_schema.tables
+    WHERE table_schema = current_schema() AND table_name = 'schema_version'`,
+	sqliteDialect: `
+    SELECT COUNT(*) FROM sqlite_master
+    WHERE type = 'table' AND name = 'schema_version'`,
+}
+
+const selectSchemaVersionSQL = `
+    SELECT version, name, checksum, applied
+    FROM schema_version
+    ORDER BY version`
+
+const insertSchemaVersionSQL = `
+    INSERT INTO schema_version (version, name, checksum, applied)
+    VALUES (?, ?, ?, NOW())`
+
+const deleteSchemaVersionSQL = `
+    DELETE FROM schema_version WHERE version = ?`
@@ -0,0 +1,135 @@
+package scrape
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	want, err := loadMigrations(mysqlDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []dialect{postgresDialect, sqliteDialect} {
+		ms, err := loadMigrations(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) != len(want) {
+			t.Errorf("%s: %d migrations, want %d", d, len(ms), len(want))
+			continue
+		}
+		for i, m := range ms {
+			if m.Name != want[i].Name {
+				t.Errorf("%s: migration %d is %s, want %s", d, m.Version, m.Name, want[i].Name)
+			}
+		}
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	db := openTestDatabase(t)
+	ms, err := loadMigrations(db.dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := len(ms)
+
+	checkVersion := func(want int) {
+		t.Helper()
+		if v, err := db.SchemaVersion(); err != nil {
+			t.Fatal(err)
+		} else if v != want {
+			t.Fatalf("schema version %d, want %d", v, want)
+		}
+	}
+	checkVersion(latest)
+	if applied, err := db.MigrateUp(-1); err != nil || len(applied) != 0 {
+		t.Fatalf("migrating an up-to-date schema applied %d migrations: %v", len(applied), err)
+	}
+
+	reverted, err := db.MigrateDown(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != latest || reverted[0].Version != latest {
+		t.Errorf("reverted %d migrations starting with %d, want %d starting with %d",
+			len(reverted), reverted[0].Version, latest, latest)
+	}
+	checkVersion(0)
+	if rows, err := db.query("SELECT 1 FROM deal_daily_snapshot"); err == nil {
+		rows.Close()
+		t.Error("deal_daily_snapshot still exists after migrating down")
+	}
+
+	if _, err := db.MigrateUp(1); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion(1)
+	if _, err := db.MigrateUp(-1); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion(latest)
+
+	// Pretend that the first migration was edited after it was applied.
+	if _, err := db.conn.Exec("UPDATE schema_version SET checksum = 'x' WHERE version = 1"); err != nil {
+		t.Fatal(err)
+	}
+	ss, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ss[0].Modified || ss[1].Modified {
+		t.Errorf("got modified %v, %v; want true, false", ss[0].Modified, ss[1].Modified)
+	}
+	if _, err := db.MigrateDown(latest - 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MigrateUp(-1); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("migrating up with a modified migration: got error %v", err)
+	}
+}
+
+func TestMigrationStatusReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scrape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := OpenDatabase("sqlite:" + filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ss, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) == 0 {
+		t.Fatal("no migrations")
+	}
+	for _, s := range ss {
+		if s.Applied != nil {
+			t.Errorf("migration %d is applied to an empty database", s.Version)
+		}
+	}
+	if v, err := db.SchemaVersion(); err != nil || v != 0 {
+		t.Errorf("got schema version %d, %v; want 0", v, err)
+	}
+	if rows, err := db.query("SELECT 1 FROM schema_version"); err == nil {
+		rows.Close()
+		t.Error("reading the migration status created schema_version")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	got := splitStatements("-- comment\ncreate table a (x int);\n\n-- only a comment;\ndrop table b;\n")
+	want := []string{"-- comment\ncreate table a (x int)", "drop table b"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -1,11 +1,12 @@
-create table site (name varchar(10) primary key);
+create table if not exists site (name varchar(10) primary key);
 
-insert into site values ('coupang');
-insert into site values ('tmon');
-insert into site values ('wmp');
-insert into site values ('groupon');
+insert ignore into site values
+    ('coupang'),
+    ('tmon'),
+    ('wmp'),
+    ('groupon');
 
-create table deal_daily_snapshot (
+create table if not exists deal_daily_snapshot (
     site varchar(10),
     deal_id bigint,
     day date,
@@ -22,7 +23,7 @@ create table deal_daily_snapshot (
     locale varchar(200),
     primary key (site, deal_id, day));
 
-create table option_daily_snapshot (
+create table if not exists option_daily_snapshot (
     site varchar(10),
     deal_id bigint,
     option_id bigint,
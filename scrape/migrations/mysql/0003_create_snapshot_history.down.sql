@@ -0,0 +1,2 @@
+drop table option_snapshot;
+drop table deal_snapshot;
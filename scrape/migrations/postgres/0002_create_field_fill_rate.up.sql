@@ -0,0 +1,8 @@
+create table if not exists field_fill_rate (
+    site varchar(10),
+    day date,
+    field varchar(20),
+    updated timestamp not null,
+    deals int not null,
+    filled int not null,
+    primary key (site, day, field));
@@ -0,0 +1,19 @@
+create table if not exists deal_snapshot (
+    site varchar(10),
+    deal_id bigint,
+    captured timestamp,
+    expired bool not null,
+    original_price int,
+    discount_price int,
+    num_sold int,
+    primary key (site, deal_id, captured));
+
+create table if not exists option_snapshot (
+    site varchar(10),
+    deal_id bigint,
+    option_id bigint,
+    captured timestamp,
+    price int,
+    num_available int,
+    num_sold int,
+    primary key (site, deal_id, option_id, captured));
@@ -0,0 +1,3 @@
+drop table option_daily_snapshot;
+drop table deal_daily_snapshot;
+drop table site;
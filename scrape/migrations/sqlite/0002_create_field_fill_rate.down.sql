@@ -0,0 +1 @@
+drop table field_fill_rate;
@@ -0,0 +1,104 @@
+package scrape
+
+import (
+	"container/list"
+	"context"
+	"log"
+)
+
+// Some sites serve a deal's options as a tree, one level per request: the
+// first level lists, say, colors, and choosing a color requests the sizes
+// in it, keyed by the path of choices made so far. WalkOptionTree requests
+// such a tree and returns its leaves, which are the options that are sold.
+
+// Option trees are never this deep; a site that claims one is most likely
+// returning the same level over and over.
+const MaxOptionDepth = 5
+
+// OptionNode is an option in a tree of options.
+type OptionNode struct {
+	Key     string // identifies the node among its siblings
+	Name    string
+	Leaf    bool // whether the node is on the last level
+	SoldOut bool // whether the node, and so everything under it, is sold out
+
+	// The leaf's numbers. SiteName, DealID and Description are filled in by
+	// WalkOptionTree.
+	Option Option
+
+	// Set by WalkOptionTree.
+	Depth  int
+	Parent *OptionNode
+}
+
+// KeyPath returns the keys of the node and its ancestors, from the root down,
+// joined by "|".
+func (n *OptionNode) KeyPath() string {
+	key := n.Key
+	for p := n.Parent; p != nil; p = p.Parent {
+		key = p.Key + "|" + key
+	}
+	return key
+}
+
+// Returns the names of the node and its ancestors, from the root down,
+// joined by "|".
+func (n *OptionNode) description() string {
+	desc := n.Name
+	for p := n.Parent; p != nil; p = p.Parent {
+		desc = p.Name + "|" + desc
+	}
+	return desc
+}
+
+// Reports whether the node or one of its ancestors is sold out.
+func (n *OptionNode) soldOut() bool {
+	for ; n != nil; n = n.Parent {
+		if n.SoldOut {
+			return true
+		}
+	}
+	return false
+}
+
+// WalkOptionTree returns the options of a deal whose option tree is fetched
+// level by level, breadth first. getLevel returns the children of a node,
+// or the first level if the node is nil. Sold out nodes are expanded too,
+// for the sales of their options, but the options under them are left with
+// nothing available. Nodes more than MaxOptionDepth levels deep are skipped,
+// and the walk stops when ctx is done.
+func WalkOptionTree(ctx context.Context, site string, id DealID, getLevel func(parent *OptionNode) []*OptionNode) []*Option {
+	var (
+		options = make([]*Option, 0)
+		q       = list.New()
+	)
+	enqueue := func(parent *OptionNode) {
+		for _, n := range getLevel(parent) {
+			n.Parent = parent
+			if parent != nil {
+				n.Depth = parent.Depth + 1
+			}
+			q.PushBack(n)
+		}
+	}
+	enqueue(nil)
+	for q.Front() != nil && ctx.Err() == nil {
+		n := q.Remove(q.Front()).(*OptionNode)
+		switch {
+		case !n.Leaf && n.Depth+1 >= MaxOptionDepth:
+			log.Printf("%s: deal %d: option %s is nested too deeply; skipping it", site, id, n.KeyPath())
+		case !n.Leaf:
+			enqueue(n)
+		default:
+			o := n.Option
+			o.SiteName = site
+			o.DealID = id
+			o.Description = n.description()
+			if n.soldOut() {
+				o.NumAvailable = 0
+			}
+			options = append(options, &o)
+		}
+	}
+	return options
+}
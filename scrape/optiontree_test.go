@@ -0,0 +1,68 @@
+package scrape
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWalkOptionTree(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		levels   map[string][]*OptionNode // keyed by the parent's key path
+		want     []Option
+		requests int
+	}{
+		{
+			name: "sold out parent",
+			levels: map[string][]*OptionNode{
+				"": {
+					{Key: "1", Name: "black"},
+					{Key: "2", Name: "white", SoldOut: true},
+				},
+				"1": {{Key: "s", Name: "S", Leaf: true, Option: Option{OptionID: 11, NumAvailable: 3, NumSold: 4}}},
+				"2": {{Key: "s", Name: "S", Leaf: true, Option: Option{OptionID: 21, NumAvailable: 5, NumSold: 6}}},
+			},
+			want: []Option{
+				{SiteName: "site", DealID: 7, OptionID: 11, Description: "black|S", NumAvailable: 3, NumSold: 4},
+				{SiteName: "site", DealID: 7, OptionID: 21, Description: "white|S", NumAvailable: 0, NumSold: 6},
+			},
+			requests: 3,
+		},
+		{
+			// A level that is returned for every key path never ends.
+			name:     "endless",
+			levels:   nil,
+			want:     nil,
+			requests: MaxOptionDepth,
+		},
+	} {
+		requests := 0
+		got := WalkOptionTree(context.Background(), "site", 7, func(parent *OptionNode) []*OptionNode {
+			requests++
+			if tt.levels == nil {
+				return []*OptionNode{{Key: "again", Name: "again"}}
+			}
+			key := ""
+			if parent != nil {
+				key = parent.KeyPath()
+			}
+			var nodes []*OptionNode
+			for _, n := range tt.levels[key] {
+				c := *n
+				nodes = append(nodes, &c)
+			}
+			return nodes
+		})
+		var options []Option
+		for _, o := range got {
+			options = append(options, *o)
+		}
+		if !reflect.DeepEqual(options, tt.want) {
+			t.Errorf("%s: got options %v, want %v", tt.name, options, tt.want)
+		}
+		if requests != tt.requests {
+			t.Errorf("%s: made %d requests, want %d", tt.name, requests, tt.requests)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package scrape
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a new Scraper.
+type Factory func() Scraper
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a scraper available under the given site name. Site packages
+// call it from their init function, so linking a package into a program is
+// enough to make its site available. Registering a name twice panics.
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("scrape: site %q registered twice", name))
+	}
+	registry[name] = f
+}
+
+// Lookup returns a new Scraper for the named site.
+func Lookup(name string) (s Scraper, ok bool) {
+	registryMu.Lock()
+	f, ok := registry[name]
+	registryMu.Unlock()
+	if ok {
+		s = f()
+	}
+	return
+}
+
+// Sites returns the names of all registered sites, sorted.
+func Sites() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,6 +1,7 @@
 package scrape
 
 import (
+	"context"
 	"github.com/launchtime/scrapemonster/crawler"
 	"net/url"
 	"strconv"
@@ -22,6 +23,9 @@ type (
 		NumSold       *int
 		Expired       bool
 		Adult         bool
+
+		// Problems found while parsing the deal's page.
+		Diagnostics Diagnostics `json:"-"`
 	}
 
 	Option struct {
@@ -49,8 +53,15 @@ type Scraper interface {
 	TransformURL(u *url.URL) *url.URL
 	DealURL(id DealID) *url.URL
 	ParseDeal(u *url.URL, body string) (*Deal, error)
-	GetDealOptions(g *crawler.Getter, id DealID) []*Option
+	GetDealOptions(ctx context.Context, g *crawler.Getter, id DealID) []*Option
 
 	// This method satisfies the crawler.URLExtractor interface.
 	ExtractURLs(body string) []*url.URL
 }
+
+// RobotsAllowlister may be implemented by a Scraper to exempt some paths on
+// its site from robots.txt. The returned map holds robots.txt path patterns
+// keyed by host.
+type RobotsAllowlister interface {
+	RobotsAllowlist() map[string][]string
+}
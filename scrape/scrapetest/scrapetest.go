@@ -0,0 +1,192 @@
+// Package scrapetest runs Scrapers against pages saved in a package's
+// testdata directory and compares the results with golden files stored
+// alongside them. Run
+//
+//	go test ./scrape/... -update
+//
+// to rewrite the golden files after an intended change, and review the diff.
+package scrapetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/launchtime/scrapemonster/crawler"
+	"github.com/launchtime/scrapemonster/scrape"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current results")
+
+// Page is a fixture: a response body saved in testdata, and the URL it was
+// fetched from.
+type Page struct {
+	URL  string
+	File string
+}
+
+// Fixture returns the contents of a file in testdata.
+func Fixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Golden compares got, encoded as indented JSON, with the golden file of the
+// given name in testdata. With -update, it writes the file instead.
+func Golden(t *testing.T, name string, got interface{}) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(got); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (run with -update to create it)", err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%s: result differs from golden file\ngot:\n%s\nwant:\n%s", path, data, want)
+	}
+}
+
+// Returns the name of the golden file holding results of the given kind for
+// a fixture, e.g. deal-123.deal.golden for deal-123.html.
+func goldenName(file, kind string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + "." + kind + ".golden"
+}
+
+func mustParse(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// A parsed deal as stored in golden files; Deal leaves out its diagnostics
+// when encoded.
+type parsedDeal struct {
+	Deal        *scrape.Deal       `json:"deal"`
+	Diagnostics scrape.Diagnostics `json:"diagnostics"`
+}
+
+// ParseDeal checks the deal that s parses from each page.
+func ParseDeal(t *testing.T, s scrape.Scraper, pages ...Page) {
+	for _, p := range pages {
+		d, err := s.ParseDeal(mustParse(t, p.URL), string(Fixture(t, p.File)))
+		if err != nil {
+			t.Errorf("%s: %s", p.File, err)
+			continue
+		}
+		got := parsedDeal{Deal: d}
+		if d != nil {
+			got.Diagnostics = d.Diagnostics
+		}
+		Golden(t, goldenName(p.File, "deal"), got)
+	}
+}
+
+// ExtractURLs checks the URLs that s extracts from each page.
+func ExtractURLs(t *testing.T, s scrape.Scraper, pages ...Page) {
+	for _, p := range pages {
+		var got []string
+		for _, u := range s.ExtractURLs(string(Fixture(t, p.File))) {
+			got = append(got, u.String())
+		}
+		Golden(t, goldenName(p.File, "urls"), got)
+	}
+}
+
+type transformedURL struct {
+	URL         string  `json:"url"`
+	Transformed *string `json:"transformed"`
+}
+
+// TransformURL checks how s transforms each of the given URLs.
+func TransformURL(t *testing.T, s scrape.Scraper, golden string, urls ...string) {
+	got := make([]transformedURL, 0, len(urls))
+	for _, in := range urls {
+		r := transformedURL{URL: in}
+		if u := s.TransformURL(mustParse(t, in)); u != nil {
+			out := u.String()
+			r.Transformed = &out
+		}
+		got = append(got, r)
+	}
+	Golden(t, golden, got)
+}
+
+// DealOptions checks the options that s gets for a deal when the option
+// requests it makes are answered with the given pages. Requests for any
+// other URL fail the test.
+func DealOptions(t *testing.T, s scrape.Scraper, id scrape.DealID, golden string, pages ...Page) {
+	rt := &fixtureTransport{t: t, pages: make(map[string]string)}
+	for _, p := range pages {
+		rt.pages[fixtureKey(mustParse(t, p.URL))] = p.File
+	}
+	g := crawler.NewTransportGetter(rt)
+	Golden(t, golden, s.GetDealOptions(context.Background(), g, id))
+}
+
+// Returns a key for the URL that does not depend on how its query string is
+// escaped or ordered.
+func fixtureKey(u *url.URL) string {
+	return u.Host + u.Path + "?" + u.Query().Encode()
+}
+
+// Serves fixtures by URL.
+type fixtureTransport struct {
+	t     *testing.T
+	pages map[string]string
+}
+
+func (rt *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	file, ok := rt.pages[fixtureKey(req.URL)]
+	if !ok {
+		rt.t.Errorf("unexpected request for %s", req.URL)
+		return &http.Response{
+			Status:     "404 Not Found",
+			StatusCode: http.StatusNotFound,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	}
+	data := Fixture(rt.t, file)
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {contentType(file)}},
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+func contentType(file string) string {
+	switch filepath.Ext(file) {
+	case ".json":
+		return "application/json; charset=utf-8"
+	case ".html", ".htm":
+		return "text/html; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
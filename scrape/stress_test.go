@@ -0,0 +1,128 @@
+package scrape
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The stress test always runs against a SQLite file. A DB keeps a single
+// connection to SQLite, so there the database serializes the writes and only
+// the DB's own locking is exercised; concurrent writes on the server need
+// SCRAPE_TEST_DATABASE, set to the URI of a scratch MySQL or PostgreSQL
+// database (see OpenDatabase). That database is migrated to the latest
+// schema and the test's rows are deleted afterwards. Run it with -race:
+//
+//	SCRAPE_TEST_DATABASE=postgres://localhost/scrapetest go test -race -run Stress ./scrape
+const stressSite = "stresstest"
+
+func TestStressConcurrentWrites(t *testing.T) {
+	dbs := map[string]*DB{"sqlite": openTestDatabase(t)}
+	if uri := os.Getenv("SCRAPE_TEST_DATABASE"); uri != "" {
+		db, err := OpenDatabase(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.MigrateUp(-1); err != nil {
+			t.Fatal(err)
+		}
+		dbs[string(db.dialect)] = db
+	} else {
+		t.Log("SCRAPE_TEST_DATABASE not set; testing against SQLite only")
+	}
+
+	for name, db := range dbs {
+		for _, prepare := range []bool{true, false} {
+			db := db
+			t.Run(fmt.Sprintf("%s/prepare=%v", name, prepare), func(t *testing.T) {
+				db.NoPrepare = !prepare
+				db.History = true
+				db.ConfigurePool(PoolConfig{
+					MaxOpenConns: 4,
+					MaxIdleConns: 2,
+					// Make connections come and go during the test.
+					ConnMaxLifetime: 50 * time.Millisecond,
+				})
+				defer cleanUpStressTest(t, db)
+				stress(t, db)
+			})
+		}
+	}
+}
+
+// Stores deals and options from many goroutines at once, reading them back
+// as it goes, and checks that the last write of each won.
+func stress(t *testing.T, db *DB) {
+	goroutines, iterations := 16, 50
+	if testing.Short() {
+		iterations = 10
+	}
+	day := time.Date(2013, 5, 1, 0, 0, 0, 0, time.UTC)
+	errs := make(chan error, goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				id := DealID(g*iterations + i)
+				d := &Deal{SiteName: stressSite, DealID: id, NumSold: intp(i)}
+				o := &Option{SiteName: stressSite, DealID: id, OptionID: OptionID(i), NumSold: i}
+				err := db.StoreDeal(d)
+				if err == nil {
+					err = db.StoreOption(o)
+				}
+				if err == nil {
+					err = db.StoreDealOn(d, day)
+				}
+				if err == nil {
+					var r *DealDailySnapshot
+					r, err = db.GetDealDailySnapshot(stressSite, id, day)
+					if err == nil && (r == nil || *r.NumSold != i) {
+						err = fmt.Errorf("deal %d: read back %+v", id, r)
+					}
+				}
+				if err == nil && i%25 == 0 {
+					err = db.UpdateFillRates(day)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	deals, err := db.GetDealDailySnapshots(day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, r := range deals {
+		if r.Site == stressSite {
+			n++
+		}
+	}
+	if want := goroutines * iterations; n != want {
+		t.Errorf("got %d deals, want %d", n, want)
+	}
+}
+
+// Deletes the rows the stress test wrote.
+func cleanUpStressTest(t *testing.T, db *DB) {
+	for _, table := range []string{"deal_daily_snapshot", "option_daily_snapshot",
+		"deal_snapshot", "option_snapshot", "field_fill_rate"} {
+		_, err := db.conn.Exec(db.dialect.translate("DELETE FROM "+table+" WHERE site = ?"), stressSite)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -7,29 +7,28 @@ import (
 	"github.com/launchtime/scrapemonster/scrape/htmlutil"
 	net_url "net/url"
 	"regexp"
-	"strconv"
 	"strings"
 )
 
 var (
-	titleSelector = cascadia.MustCompile(`head title`)
+	titleSelector = scrape.MustCompileSelector(`head title`)
 
-	gnbActiveSectionTabsSelector = cascadia.MustCompile(
+	gnbActiveSectionTabsSelector = scrape.MustCompileSelector(
 		`div.gnb_section ul.tab_gnb > li.on > a`)
 
-	gnbActiveSubmenuSelector = cascadia.MustCompile(
+	gnbActiveSubmenuSelector = scrape.MustCompileSelector(
 		`div.gnb_section div.submenu ul > li.on > a`)
 
 	gnbLocaleRegexp = regexp.MustCompile(
 		`return \(/\(\\b(\d+)\\b\)/.test\(this.href\)\);`)
 
-	gnbLocaleSelector = cascadia.MustCompile(`div.gnb_section.local ul > li > a`)
+	gnbLocaleSelector = scrape.MustCompileSelector(`div.gnb_section.local ul > li > a`)
 
 	numSoldRegexp = regexp.MustCompile(`countUpTo\((\d+)\)`)
 
-	originalPriceSelector = cascadia.MustCompile(`.price_info .price .old em`)
+	originalPriceSelector = scrape.MustCompileSelector(`.price_info .price .old em`)
 
-	discountPriceSelector = cascadia.MustCompile(`.price_info .price .now_price`)
+	discountPriceSelector = scrape.MustCompileSelector(`.price_info .price .now_price`)
 
 	buyButtonSelector = cascadia.MustCompile(`a#buy_button`)
 
@@ -43,6 +42,7 @@ var (
 type dealPage struct {
 	body string
 	root *html.Node
+	diag scrape.Diagnostics
 }
 
 func newDealPage(body string) (p *dealPage, err error) {
@@ -60,43 +60,38 @@ func (p *dealPage) exists() bool {
 }
 
 func (p *dealPage) description() *string {
-	nodes := titleSelector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		return htmlutil.FirstText(nodes[0])
-	}
-	return nil
+	n := p.diag.MatchOne("description", p.root, titleSelector)
+	return p.diag.FirstText("description", n)
 }
 
 func (p *dealPage) category() *string {
-	nodes := gnbActiveSectionTabsSelector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		return htmlutil.FirstText(nodes[0])
-	}
-	return nil
+	n := p.diag.MatchOne("category", p.root, gnbActiveSectionTabsSelector)
+	return p.diag.FirstText("category", n)
 }
 
 func (p *dealPage) subcategory() *string {
-	nodes := gnbActiveSubmenuSelector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		return htmlutil.FirstText(nodes[0])
-	}
-	return nil
+	n := p.diag.MatchOne("subcategory", p.root, gnbActiveSubmenuSelector)
+	return p.diag.FirstText("subcategory", n)
 }
 
 func (p *dealPage) locale() []string {
 	// Look for the javascript code that highlights the local subsection.
 	matches := gnbLocaleRegexp.FindAllStringSubmatch(p.body, -1)
 	if len(matches) != 1 {
+		p.diag.Add("locale", scrape.Missing)
 		return nil
 	}
-	dealListID, err := strconv.ParseInt(matches[0][1], 10, 64)
-	if err != nil {
+	dealListID := p.diag.Integer("locale", matches[0][1])
+	if dealListID == nil {
 		return nil
 	}
 
 	// For every link in the local subsection of the global nav:
 	baseURL := baseURL()
-	nodes := gnbLocaleSelector.MatchAll(p.root)
+	nodes := p.diag.MatchAll("locale", p.root, gnbLocaleSelector)
+	if len(nodes) == 0 {
+		return nil // MatchAll recorded the problem
+	}
 	for _, node := range nodes {
 		// Find the href attribute.
 		if attr := htmlutil.GetAttr(node, "href"); attr != nil {
@@ -104,9 +99,9 @@ func (p *dealPage) locale() []string {
 			if url, err := net_url.Parse(attr.Val); err == nil {
 				url = baseURL.ResolveReference(url)
 				// If the link points to our deal list page...
-				if id, ok := parseDealListURL(url); ok && int64(id) == dealListID {
+				if id, ok := parseDealListURL(url); ok && int64(id) == int64(*dealListID) {
 					// ...return the link's text node.
-					if s := htmlutil.FirstText(node); s != nil {
+					if s := p.diag.FirstText("locale", node); s != nil {
 						return []string{*s}
 					}
 					return nil
@@ -114,25 +109,24 @@ func (p *dealPage) locale() []string {
 			}
 		}
 	}
+	p.diag.Add("locale", scrape.Missing)
 	return nil
 }
 
 func (p *dealPage) originalPrice() *int {
-	return htmlutil.ExtractInteger(p.root, originalPriceSelector)
+	return p.diag.ExtractInteger("original_price", p.root, originalPriceSelector)
 }
 
 func (p *dealPage) discountPrice() *int {
-	return htmlutil.ExtractInteger(p.root, discountPriceSelector)
+	return p.diag.ExtractInteger("discount_price", p.root, discountPriceSelector)
 }
 
 func (p *dealPage) numSold() *int {
 	matches := numSoldRegexp.FindAllStringSubmatch(p.body, -1)
 	if len(matches) >= 1 {
-		s := matches[len(matches)-1][1]
-		if i, err := strconv.Atoi(s); err == nil {
-			return &i
-		}
+		return p.diag.Integer("num_sold", matches[len(matches)-1][1])
 	}
+	p.diag.Add("num_sold", scrape.Missing)
 	return nil
 }
 
@@ -175,5 +169,6 @@ func (s *Scraper) ParseDeal(u *net_url.URL, body string) (d *scrape.Deal, err er
 		Expired:       p.expired(),
 		Adult:         p.adult(),
 	}
+	d.Diagnostics = p.diag
 	return
 }
@@ -2,6 +2,7 @@ package tmon
 
 import (
 	"container/list"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/launchtime/scrapemonster/crawler"
@@ -11,7 +12,7 @@ import (
 )
 
 type Getter interface {
-	GetBody(url string) (body []byte, err error)
+	GetBody(ctx context.Context, url string) (body []byte, err error)
 }
 
 type fuzzyString string
@@ -94,7 +95,7 @@ func unmarshalOptions(body []byte) (options []*rawOption, err error) {
 	return
 }
 
-func getOptions(g *crawler.Getter, dealID scrape.DealID, parent *rawOption) (options []*rawOption) {
+func getOptions(ctx context.Context, g *crawler.Getter, dealID scrape.DealID, parent *rawOption) (options []*rawOption) {
 	var (
 		body   []byte
 		err    error
@@ -108,7 +109,7 @@ func getOptions(g *crawler.Getter, dealID scrape.DealID, parent *rawOption) (opt
 	}
 
 	url := urlForGetOptionList(dealID, depth, optKey).String()
-	body, err = g.GetBody(url)
+	body, err = g.GetBody(ctx, url)
 	if err != nil {
 		log.Print(err.Error())
 		return
@@ -128,7 +129,7 @@ func getOptions(g *crawler.Getter, dealID scrape.DealID, parent *rawOption) (opt
 	return
 }
 
-func (s *Scraper) GetDealOptions(g *crawler.Getter, id scrape.DealID) []*scrape.Option {
+func (s *Scraper) GetDealOptions(ctx context.Context, g *crawler.Getter, id scrape.DealID) []*scrape.Option {
 	var (
 		options = make([]*scrape.Option, 0)
 		q       = list.New()
@@ -138,11 +139,11 @@ func (s *Scraper) GetDealOptions(g *crawler.Getter, id scrape.DealID) []*scrape.
 			q.PushBack(o)
 		}
 	}
-	enqueueOptions(getOptions(g, id, nil))
-	for q.Front() != nil {
+	enqueueOptions(getOptions(ctx, g, id, nil))
+	for q.Front() != nil && ctx.Err() == nil {
 		rawopt := q.Remove(q.Front()).(*rawOption)
 		if rawopt.depth < rawopt.maxDepth {
-			enqueueOptions(getOptions(g, id, rawopt))
+			enqueueOptions(getOptions(ctx, g, id, rawopt))
 		} else {
 			o := &scrape.Option{
 				SiteName:     s.Name(),
@@ -1,7 +1,15 @@
 package tmon
 
+import (
+	"github.com/launchtime/scrapemonster/scrape"
+)
+
 type Scraper int
 
+func init() {
+	scrape.Register("tmon", func() scrape.Scraper { return new(Scraper) })
+}
+
 func (_ *Scraper) Name() string {
 	return "tmon"
 }
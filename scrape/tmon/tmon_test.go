@@ -0,0 +1,44 @@
+package tmon
+
+import (
+	"github.com/launchtime/scrapemonster/scrape/scrapetest"
+	"testing"
+)
+
+var dealPages = []scrapetest.Page{
+	{URL: "http://www.ticketmonster.co.kr/deal/14562681", File: "deal-14562681.html"},
+	{URL: "http://www.ticketmonster.co.kr/deal/14409937", File: "deal-14409937.html"},
+	{URL: "http://www.ticketmonster.co.kr/deal/14500000", File: "deal-adult.html"},
+	{URL: "http://www.ticketmonster.co.kr/deal/1", File: "deal-notfound.html"},
+	// A local deal without the local nav, and one whose locale script names
+	// a deal list ID out of range; each should get one locale diagnostic.
+	{URL: "http://www.ticketmonster.co.kr/deal/14562682", File: "deal-nolocalnav.html"},
+	{URL: "http://www.ticketmonster.co.kr/deal/14562683", File: "deal-badlocale.html"},
+}
+
+func TestParseDeal(t *testing.T) {
+	scrapetest.ParseDeal(t, new(Scraper), dealPages...)
+}
+
+func TestExtractURLs(t *testing.T) {
+	scrapetest.ExtractURLs(t, new(Scraper), dealPages[0])
+}
+
+func TestTransformURL(t *testing.T) {
+	scrapetest.TransformURL(t, new(Scraper), "transform.golden",
+		"http://www.ticketmonster.co.kr/deal/14562681",
+		"http://www.ticketmonster.co.kr/deal/14562681?coupon=1#detail",
+		"http://www.ticketmonster.co.kr/deallist/12",
+		"http://www.ticketmonster.co.kr/deallist/12/2",
+		"http://www.ticketmonster.co.kr/home/",
+		"http://www.coupang.com/deal/14562681",
+	)
+}
+
+func TestGetDealOptions(t *testing.T) {
+	scrapetest.DealOptions(t, new(Scraper), 14562681, "options.golden",
+		scrapetest.Page{URL: "http://www.ticketmonster.co.kr/deal/getOptionList/14562681/0?opt_key=", File: "options-depth0.json"},
+		scrapetest.Page{URL: "http://www.ticketmonster.co.kr/deal/getOptionList/14562681/1?opt_key=1|", File: "options-depth1-1.json"},
+		scrapetest.Page{URL: "http://www.ticketmonster.co.kr/deal/getOptionList/14562681/1?opt_key=2|", File: "options-depth1-2.json"},
+	)
+}
@@ -7,32 +7,56 @@ import (
 	"github.com/launchtime/scrapemonster/scrape"
 	"github.com/launchtime/scrapemonster/scrape/htmlutil"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 var (
-	categorySelector = cascadia.MustCompile("#gnb ul.gnb_menu > li.on a span.hide")
+	descriptionSelectorFormat = "img#img_onecut_%d"
 
-	subcategorySelector = cascadia.MustCompile("#div_section_gnbsub ul > li.on a")
+	categorySelector = scrape.MustCompileSelector("#gnb ul.gnb_menu > li.on a span.hide")
 
-	localeSelectors = []cascadia.Selector{
-		cascadia.MustCompile(".gnb_section.region .gnb_sub h3.on a"),
-		cascadia.MustCompile(".gnb_section.region .gnb_sub ul > li.on a"),
+	subcategorySelector = scrape.MustCompileSelector("#div_section_gnbsub ul > li.on a")
+
+	localeSelectors = []scrape.Selector{
+		scrape.MustCompileSelector(".gnb_section.region .gnb_sub h3.on a"),
+		scrape.MustCompileSelector(".gnb_section.region .gnb_sub ul > li.on a"),
 	}
 
-	numSoldSelector = cascadia.MustCompile("#buy_num")
+	numSoldSelector = scrape.MustCompileSelector("#buy_num")
 
-	originalPriceSelector = cascadia.MustCompile(
+	originalPriceSelector = scrape.MustCompileSelector(
 		".price_area .ba_origin_price")
 
-	discountPriceSelector = cascadia.MustCompile(
+	discountPriceSelector = scrape.MustCompileSelector(
 		".price_area .ba_sale_price")
+
+	buyButtonSelector = cascadia.MustCompile(".deal_btn_area a.btn_buy")
+
+	endButtonSelector = cascadia.MustCompile(".deal_btn_area .btn_end")
+
+	// Labels of the buy button once a deal can no longer be bought.
+	expiredButtonRegexp = regexp.MustCompile(`판매\s*(?:종료|마감)|매진|품절`)
+
+	// The deal's countdown script sits in the deal view or at the top level
+	// of the body, and declares the seconds left until the deal ends in a
+	// variable. Scripts elsewhere, such as the timers of related deals, are
+	// not the deal's.
+	remainTimeScriptSelector = cascadia.MustCompile("body > script, .deal_view script")
+
+	remainTimeRegexp = regexp.MustCompile(`(?:^|[;\n])\s*var\s+remain_?[tT]ime\s*=\s*["']?(-?\d+)`)
+
+	adultWarningSelector = cascadia.MustCompile("#adult_auth, div.adult_certify")
+
+	adultWarningRegexp = regexp.MustCompile(`청소년보호법|19세 미만`)
 )
 
 type dealPage struct {
 	dealID scrape.DealID
 	body   string
 	root   *html.Node
+	diag   scrape.Diagnostics
 }
 
 func newDealPage(id scrape.DealID, body string) (p *dealPage, err error) {
@@ -41,69 +65,84 @@ func newDealPage(id scrape.DealID, body string) (p *dealPage, err error) {
 	if err != nil {
 		return
 	}
-	p = &dealPage{id, body, root}
+	p = &dealPage{dealID: id, body: body, root: root}
 	return
 }
 
 func (p *dealPage) description() *string {
-	selector := cascadia.MustCompile(fmt.Sprintf("img#img_onecut_%d", p.dealID))
-	nodes := selector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		if attr := htmlutil.GetAttr(nodes[0], "alt"); attr != nil {
-			s := attr.Val
-			return &s
-		}
+	// Named after the format, so that the problems of all deals add up.
+	selector := scrape.Selector{
+		Selector: cascadia.MustCompile(fmt.Sprintf(descriptionSelectorFormat, p.dealID)),
+		Source:   descriptionSelectorFormat,
 	}
-	return nil
+	n := p.diag.MatchOne("description", p.root, selector)
+	return p.diag.Attr("description", n, "alt")
 }
 
 func (p *dealPage) category() *string {
-	nodes := categorySelector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		return htmlutil.FirstText(nodes[0])
-	}
-	return nil
+	n := p.diag.MatchOne("category", p.root, categorySelector)
+	return p.diag.FirstText("category", n)
 }
 
 func (p *dealPage) subcategory() *string {
-	nodes := subcategorySelector.MatchAll(p.root)
-	if len(nodes) == 1 {
-		return htmlutil.FirstText(nodes[0])
-	}
-	return nil
+	n := p.diag.MatchOne("subcategory", p.root, subcategorySelector)
+	return p.diag.FirstText("subcategory", n)
 }
 
 func (p *dealPage) locale() []string {
 	var locale []string
 	for _, sel := range localeSelectors {
-		nodes := sel.MatchAll(p.root)
-		if len(nodes) == 1 {
-			if s := htmlutil.FirstText(nodes[0]); s != nil {
-				locale = append(locale, *s)
-			}
+		n := p.diag.MatchOne("locale", p.root, sel)
+		if s := p.diag.FirstText("locale", n); s != nil {
+			locale = append(locale, *s)
 		}
 	}
 	return locale
 }
 
 func (p *dealPage) originalPrice() *int {
-	return htmlutil.ExtractInteger(p.root, originalPriceSelector)
+	return p.diag.ExtractInteger("original_price", p.root, originalPriceSelector)
 }
 
 func (p *dealPage) discountPrice() *int {
-	return htmlutil.ExtractInteger(p.root, discountPriceSelector)
+	return p.diag.ExtractInteger("discount_price", p.root, discountPriceSelector)
 }
 
 func (p *dealPage) numSold() *int {
-	return htmlutil.ExtractInteger(p.root, numSoldSelector)
+	return p.diag.ExtractInteger("num_sold", p.root, numSoldSelector)
 }
 
 func (p *dealPage) expired() bool {
+	if len(endButtonSelector.MatchAll(p.root)) != 0 {
+		return true
+	}
+	for _, n := range buyButtonSelector.MatchAll(p.root) {
+		if s := htmlutil.FirstText(n); s != nil && expiredButtonRegexp.MatchString(*s) {
+			return true
+		}
+	}
+	if remain := p.remainTime(); remain != nil && *remain <= 0 {
+		return true
+	}
 	return false
 }
 
+// Returns the number of seconds left on the deal's end-time countdown.
+func (p *dealPage) remainTime() *int {
+	for _, n := range remainTimeScriptSelector.MatchAll(p.root) {
+		matches := remainTimeRegexp.FindStringSubmatch(htmlutil.TreeText(n))
+		if matches != nil {
+			if i, err := strconv.Atoi(matches[1]); err == nil {
+				return &i
+			}
+		}
+	}
+	return nil
+}
+
 func (p *dealPage) adult() bool {
-	return false
+	return len(adultWarningSelector.MatchAll(p.root)) >= 1 &&
+		adultWarningRegexp.FindStringSubmatch(p.body) != nil
 }
 
 func (s *Scraper) ParseDeal(u *url.URL, body string) (d *scrape.Deal, err error) {
@@ -128,5 +167,6 @@ func (s *Scraper) ParseDeal(u *url.URL, body string) (d *scrape.Deal, err error)
 		Expired:       p.expired(),
 		Adult:         p.adult(),
 	}
+	d.Diagnostics = p.diag
 	return
 }
@@ -1,10 +1,170 @@
 package wmp
 
 import (
+	"code.google.com/p/cascadia"
+	"code.google.com/p/go.net/html"
+	"container/list"
+	"context"
 	"github.com/launchtime/scrapemonster/crawler"
 	"github.com/launchtime/scrapemonster/scrape"
+	"github.com/launchtime/scrapemonster/scrape/htmlutil"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-func (s *Scraper) GetDealOptions(g *crawler.Getter, id scrape.DealID) []*scrape.Option {
-	return nil
+// The option layer is an HTML fragment with a <select> for one level of the
+// deal's option tree. Every <option> carries its numbers in data attributes;
+// options with data-last="N" are expanded by requesting the layer again for
+// the next level, while the others (data-last="Y", or no data-last at all)
+// are on the last level.
+var (
+	optionSelector = cascadia.MustCompile(`select.option_select option[value]`)
+
+	soldOutRegexp = regexp.MustCompile(`품절`)
+)
+
+// Option trees are never this deep; a layer that claims to be is most likely
+// the server returning the same level over and over.
+const maxOptionDepth = 5
+
+type rawOption struct {
+	key         string
+	optionID    int64
+	name        string
+	price       int
+	remainCount int
+	buyCount    int
+	last        bool
+	depth       int
+	parent      *rawOption
+}
+
+// Returns the keys of the option and its ancestors, joined by "|".
+func (o *rawOption) optKey() string {
+	key := o.key
+	for p := o.parent; p != nil; p = p.parent {
+		key = p.key + "|" + key
+	}
+	return key
+}
+
+// Returns the names of the option and its ancestors, joined by "|".
+func (o *rawOption) description() string {
+	desc := o.name
+	for p := o.parent; p != nil; p = p.parent {
+		desc = p.name + "|" + desc
+	}
+	return desc
+}
+
+func attrInt(n *html.Node, key string) int {
+	if attr := htmlutil.GetAttr(n, key); attr != nil {
+		if i, err := strconv.Atoi(htmlutil.RemoveNonDigits(attr.Val)); err == nil {
+			return i
+		}
+	}
+	return 0
+}
+
+func parseOptionLayer(body string) (options []*rawOption, err error) {
+	var root *html.Node
+	root, err = html.Parse(strings.NewReader(body))
+	if err != nil {
+		return
+	}
+	for _, n := range optionSelector.MatchAll(root) {
+		key := htmlutil.GetAttr(n, "value")
+		if key == nil || key.Val == "" {
+			continue // the "please choose" placeholder
+		}
+		o := &rawOption{
+			key:         key.Val,
+			last:        true,
+			optionID:    int64(attrInt(n, "data-option_no")),
+			name:        strings.TrimSpace(htmlutil.TreeText(n)),
+			price:       attrInt(n, "data-price"),
+			remainCount: attrInt(n, "data-stock"),
+			buyCount:    attrInt(n, "data-sell"),
+		}
+		if attr := htmlutil.GetAttr(n, "data-last"); attr != nil {
+			o.last = attr.Val != "N"
+		}
+		// Sold out options may omit their stock count.
+		if htmlutil.GetAttr(n, "disabled") != nil || soldOutRegexp.MatchString(o.name) {
+			o.remainCount = 0
+		}
+		// Fall back on the key, which is the option number on most deals.
+		if o.optionID == 0 {
+			o.optionID, _ = strconv.ParseInt(o.key, 10, 64)
+		}
+		options = append(options, o)
+	}
+	return
+}
+
+func getOptions(ctx context.Context, g *crawler.Getter, dealID scrape.DealID, parent *rawOption) (options []*rawOption) {
+	var (
+		body   []byte
+		err    error
+		depth  int
+		optKey string
+	)
+
+	if parent != nil {
+		depth = parent.depth + 1
+		optKey = parent.optKey()
+	}
+
+	url := urlForGetOptionList(dealID, depth, optKey).String()
+	body, err = g.GetBody(ctx, url)
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+
+	options, err = parseOptionLayer(string(body))
+	if err != nil {
+		log.Print(err.Error())
+	}
+
+	for _, o := range options {
+		o.depth = depth
+		o.parent = parent
+	}
+	return
+}
+
+func (s *Scraper) GetDealOptions(ctx context.Context, g *crawler.Getter, id scrape.DealID) []*scrape.Option {
+	var (
+		options = make([]*scrape.Option, 0)
+		q       = list.New()
+	)
+	enqueueOptions := func(opts []*rawOption) {
+		for _, o := range opts {
+			q.PushBack(o)
+		}
+	}
+	enqueueOptions(getOptions(ctx, g, id, nil))
+	for q.Front() != nil && ctx.Err() == nil {
+		rawopt := q.Remove(q.Front()).(*rawOption)
+		if !rawopt.last && rawopt.depth+1 >= maxOptionDepth {
+			log.Printf("wmp: deal %d: option %s is nested too deeply; skipping it", id, rawopt.optKey())
+		} else if !rawopt.last {
+			enqueueOptions(getOptions(ctx, g, id, rawopt))
+		} else {
+			o := &scrape.Option{
+				SiteName:     s.Name(),
+				DealID:       id,
+				OptionID:     scrape.OptionID(rawopt.optionID),
+				Description:  rawopt.description(),
+				Price:        rawopt.price,
+				NumAvailable: rawopt.remainCount,
+				NumSold:      rawopt.buyCount,
+			}
+			options = append(options, o)
+		}
+	}
+	return options
 }
@@ -37,9 +37,15 @@ func urlForDealList(id dealListID) *url.URL {
 	return u
 }
 
-func urlForGetOptionList(id scrape.DealID) *url.URL {
+func urlForGetOptionList(id scrape.DealID, depth int, optKey string) *url.URL {
 	u := baseURL()
 	u.Path = fmt.Sprintf("/c/wmp_cart/option_layer/deal/%d", id)
+	if depth > 0 {
+		q := u.Query()
+		q.Set("depth", strconv.Itoa(depth))
+		q.Set("opt_key", optKey)
+		u.RawQuery = q.Encode()
+	}
 	return u
 }
 
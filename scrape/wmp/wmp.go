@@ -1,7 +1,15 @@
 package wmp
 
+import (
+	"github.com/launchtime/scrapemonster/scrape"
+)
+
 type Scraper int
 
+func init() {
+	scrape.Register("wmp", func() scrape.Scraper { return new(Scraper) })
+}
+
 func (_ *Scraper) Name() string {
 	return "wmp"
 }
@@ -0,0 +1,57 @@
+package wmp
+
+import (
+	"fmt"
+	"github.com/launchtime/scrapemonster/scrape/scrapetest"
+	"testing"
+)
+
+var dealPages = []scrapetest.Page{
+	{URL: "http://www.wemakeprice.com/deal/adeal/1123581", File: "deal-1123581.html"},
+	{URL: "http://www.wemakeprice.com/deal/adeal/1120000", File: "deal-1120000.html"},
+	{URL: "http://www.wemakeprice.com/deal/adeal/1100000", File: "deal-adult.html"},
+}
+
+func TestParseDeal(t *testing.T) {
+	scrapetest.ParseDeal(t, new(Scraper), dealPages...)
+}
+
+func TestExtractURLs(t *testing.T) {
+	scrapetest.ExtractURLs(t, new(Scraper), dealPages[0])
+}
+
+func TestTransformURL(t *testing.T) {
+	scrapetest.TransformURL(t, new(Scraper), "transform.golden",
+		"http://www.wemakeprice.com/deal/adeal/1123581",
+		"http://www.wemakeprice.com/deal/adeal/1123581/?source=main",
+		"http://www.wemakeprice.com/main/travel/101",
+		"http://www.wemakeprice.com/wmp_top_menu/shopping",
+		"http://www.wemakeprice.com/c/wmp_cart/order/1123581",
+	)
+}
+
+func TestGetDealOptions(t *testing.T) {
+	scrapetest.DealOptions(t, new(Scraper), 1120000, "options.golden",
+		scrapetest.Page{URL: "http://www.wemakeprice.com/c/wmp_cart/option_layer/deal/1120000", File: "options-depth0.html"},
+		scrapetest.Page{URL: "http://www.wemakeprice.com/c/wmp_cart/option_layer/deal/1120000?depth=1&opt_key=501", File: "options-depth1-501.html"},
+		scrapetest.Page{URL: "http://www.wemakeprice.com/c/wmp_cart/option_layer/deal/1120000?depth=1&opt_key=502", File: "options-depth1-502.html"},
+	)
+}
+
+func TestParseOptionLayerLast(t *testing.T) {
+	options, err := parseOptionLayer(`<select class="option_select">
+<option value="1" data-last="N">a</option>
+<option value="2" data-last="Y">b</option>
+<option value="3">c</option>
+</select>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last []bool
+	for _, o := range options {
+		last = append(last, o.last)
+	}
+	if fmt.Sprint(last) != "[false true true]" {
+		t.Errorf("got last = %v, want only the data-last=\"N\" option expanded", last)
+	}
+}
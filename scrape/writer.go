@@ -0,0 +1,417 @@
+package scrape
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/launchtime/scrapemonster/crawler"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Writer stores deals and options in a DB in batches: the rows written to it
+// are buffered, and each batch is stored by multi-row statements in one
+// transaction. A batch is stored once it is full, and whatever is buffered
+// is stored every flush interval, so that no row waits long. Batches are
+// stored in order by a goroutine of the Writer's own, so that a slow
+// database holds up the callers only once several batches are waiting. It is
+// safe for concurrent use.
+//
+// A batch that fails with a deadlock or a lost connection is retried; if it
+// still fails, all its rows are reported to the Failed callback instead of
+// ending the program. A batch that fails for another reason, such as a row
+// the database rejects, is stored one row at a time, and only the rows that
+// fail are reported.
+type Writer struct {
+	// Failed batches are retried up to MaxRetries times, waiting a
+	// randomized, exponentially growing delay between MinBackoff and
+	// MaxBackoff before each retry.
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Failed, if not nil, is called with each row that could not be stored.
+	// It is called from the Writer's goroutine.
+	Failed func(*WriteError)
+
+	// The settings above must not be changed after the first write.
+
+	db        *DB
+	batchSize int
+
+	mu      sync.Mutex // guards deals, options and after
+	deals   []dealRow
+	options []optionRow
+	after   []func() // see AfterStored
+
+	queueMu sync.Mutex // serializes queueing, so batches are stored in order
+	queue   chan *writeBatch
+	stored  chan bool // closed when the queue has been drained
+	stop    chan bool
+	done    chan bool
+}
+
+// The number of batches that may wait to be stored before writers block.
+const maxQueuedBatches = 4
+
+// Buffered rows on their way to the database, and the callbacks to call once
+// they are stored.
+type writeBatch struct {
+	deals   []dealRow
+	options []optionRow
+	after   []func()
+	flushed chan bool // closed once stored, if not nil
+}
+
+// WriteError reports a deal or option that a Writer could not store.
+type WriteError struct {
+	Deal   *Deal   // the deal, or nil if it was an option
+	Option *Option // the option, or nil if it was a deal
+	Err    error
+}
+
+func (e *WriteError) Error() string {
+	if e.Deal != nil {
+		return fmt.Sprintf("storing %s deal %d: %s", e.Deal.SiteName, e.Deal.DealID, e.Err)
+	}
+	return fmt.Sprintf("storing %s deal %d option %d: %s",
+		e.Option.SiteName, e.Option.DealID, e.Option.OptionID, e.Err)
+}
+
+// A row waiting to be stored, and when it was written (for its day and the
+// intraday history).
+type dealRow struct {
+	d        *Deal
+	captured time.Time
+}
+
+type optionRow struct {
+	o        *Option
+	captured time.Time
+}
+
+// NewWriter returns a Writer that stores rows in batches of up to batchSize
+// rows, at least every flushInterval. Close it to store the rest.
+func (db *DB) NewWriter(batchSize int, flushInterval time.Duration) *Writer {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	w := &Writer{
+		MaxRetries: 3,
+		MinBackoff: 500 * time.Millisecond,
+		MaxBackoff: 30 * time.Second,
+		db:         db,
+		batchSize:  batchSize,
+		queue:      make(chan *writeBatch, maxQueuedBatches),
+		stored:     make(chan bool),
+		stop:       make(chan bool),
+		done:       make(chan bool),
+	}
+	go w.storeQueued()
+	go w.flushPeriodically(flushInterval)
+	return w
+}
+
+// Stores the queued batches until the queue is closed.
+func (w *Writer) storeQueued() {
+	defer close(w.stored)
+	for b := range w.queue {
+		w.store(b)
+	}
+}
+
+func (w *Writer) flushPeriodically(interval time.Duration) {
+	defer close(w.done)
+	if interval <= 0 {
+		<-w.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.enqueue(false)
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// StoreDeal buffers the deal, and queues the buffered rows to be stored if
+// there is a full batch of them.
+func (w *Writer) StoreDeal(d *Deal) {
+	w.mu.Lock()
+	w.deals = append(w.deals, dealRow{d, time.Now()})
+	full := len(w.deals) >= w.batchSize
+	w.mu.Unlock()
+	if full {
+		w.enqueue(false)
+	}
+}
+
+// StoreOption is like StoreDeal, for options.
+func (w *Writer) StoreOption(o *Option) {
+	w.mu.Lock()
+	w.options = append(w.options, optionRow{o, time.Now()})
+	full := len(w.options) >= w.batchSize
+	w.mu.Unlock()
+	if full {
+		w.enqueue(false)
+	}
+}
+
+// AfterStored arranges for f to be called once every row written so far has
+// been stored, or reported to Failed. It is called from the Writer's
+// goroutine.
+func (w *Writer) AfterStored(f func()) {
+	w.mu.Lock()
+	w.after = append(w.after, f)
+	w.mu.Unlock()
+}
+
+// Flush stores the buffered rows, and returns once they and every row
+// queued before them are stored.
+func (w *Writer) Flush() {
+	<-w.enqueue(true).flushed
+}
+
+// Queues the buffered rows to be stored, waiting if the queue is full. If
+// wait is set, the returned batch's flushed channel is closed once they are
+// stored; otherwise the batch may be nil.
+func (w *Writer) enqueue(wait bool) (b *writeBatch) {
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	w.mu.Lock()
+	b = &writeBatch{deals: w.deals, options: w.options, after: w.after}
+	w.deals, w.options, w.after = nil, nil, nil
+	w.mu.Unlock()
+	if wait {
+		b.flushed = make(chan bool)
+	} else if len(b.deals) == 0 && len(b.options) == 0 && len(b.after) == 0 {
+		return nil
+	}
+	w.queue <- b
+	return
+}
+
+// Stores a queued batch, in batchSize pieces.
+func (w *Writer) store(b *writeBatch) {
+	defer func() {
+		for _, f := range b.after {
+			f()
+		}
+		if b.flushed != nil {
+			close(b.flushed)
+		}
+	}()
+	deals, options := b.deals, b.options
+	for i := 0; i < len(deals); i += w.batchSize {
+		j := i + w.batchSize
+		if j > len(deals) {
+			j = len(deals)
+		}
+		w.storeDeals(deals[i:j])
+	}
+	for i := 0; i < len(options); i += w.batchSize {
+		j := i + w.batchSize
+		if j > len(options) {
+			j = len(options)
+		}
+		w.storeOptions(options[i:j])
+	}
+}
+
+// Close stores the buffered rows and stops the Writer's goroutines. It
+// does not close the DB. The Writer must not be used afterwards.
+func (w *Writer) Close() {
+	close(w.stop)
+	<-w.done
+	w.Flush()
+	close(w.queue)
+	<-w.stored
+}
+
+// Stores a batch of deals. If the batch fails for a reason other than the
+// database being unavailable, each of its deals is stored on its own, so
+// that one bad row doesn't lose the others.
+func (w *Writer) storeDeals(rows []dealRow) {
+	err := w.execTx(w.dealStmts(rows))
+	if err == nil {
+		return
+	}
+	if len(rows) == 1 || retryable(err) {
+		for _, r := range rows {
+			w.fail(&WriteError{Deal: r.d, Err: err})
+		}
+		return
+	}
+	for i := range rows {
+		w.storeDeals(rows[i : i+1])
+	}
+}
+
+func (w *Writer) storeOptions(rows []optionRow) {
+	err := w.execTx(w.optionStmts(rows))
+	if err == nil {
+		return
+	}
+	if len(rows) == 1 || retryable(err) {
+		for _, r := range rows {
+			w.fail(&WriteError{Option: r.o, Err: err})
+		}
+		return
+	}
+	for i := range rows {
+		w.storeOptions(rows[i : i+1])
+	}
+}
+
+func (w *Writer) fail(e *WriteError) {
+	if w.Failed != nil {
+		w.Failed(e)
+	}
+}
+
+// A statement and its parameters.
+type batchStmt struct {
+	sql  string
+	args []interface{}
+}
+
+// Returns the statements that store a batch of deals. A deal written more
+// than once a day keeps the last version in its daily snapshot, since
+// PostgreSQL cannot update a row twice in one statement.
+func (w *Writer) dealStmts(rows []dealRow) (stmts []batchStmt) {
+	type key struct {
+		site string
+		id   DealID
+		day  time.Time
+	}
+	last := make(map[key]int)
+	for i, r := range rows {
+		last[key{r.d.SiteName, r.d.DealID, Day(r.captured)}] = i
+	}
+	daily := batchStmt{}
+	for i, r := range rows {
+		if day := Day(r.captured); last[key{r.d.SiteName, r.d.DealID, day}] == i {
+			daily.args = append(daily.args, w.db.dealArgs(r.d, day)...)
+		}
+	}
+	daily.sql = repeatValues(insertDealDailySnapshotSQL, len(last))
+	stmts = append(stmts, daily)
+
+	if w.db.History {
+		history := batchStmt{sql: repeatValues(insertDealSnapshotSQL, len(rows))}
+		for _, r := range rows {
+			history.args = append(history.args, w.db.dealSnapshotArgs(r.d, r.captured)...)
+		}
+		stmts = append(stmts, history)
+	}
+	return
+}
+
+func (w *Writer) optionStmts(rows []optionRow) (stmts []batchStmt) {
+	type key struct {
+		site     string
+		dealID   DealID
+		optionID OptionID
+		day      time.Time
+	}
+	last := make(map[key]int)
+	for i, r := range rows {
+		last[key{r.o.SiteName, r.o.DealID, r.o.OptionID, Day(r.captured)}] = i
+	}
+	daily := batchStmt{}
+	for i, r := range rows {
+		if day := Day(r.captured); last[key{r.o.SiteName, r.o.DealID, r.o.OptionID, day}] == i {
+			daily.args = append(daily.args, w.db.optionArgs(r.o, day)...)
+		}
+	}
+	daily.sql = repeatValues(insertOptionDailySnapshotSQL, len(last))
+	stmts = append(stmts, daily)
+
+	if w.db.History {
+		history := batchStmt{sql: repeatValues(insertOptionSnapshotSQL, len(rows))}
+		for _, r := range rows {
+			history.args = append(history.args, w.db.optionSnapshotArgs(r.o, r.captured)...)
+		}
+		stmts = append(stmts, history)
+	}
+	return
+}
+
+// Runs the statements in one transaction, retrying it if it fails in a way
+// that is worth retrying.
+func (w *Writer) execTx(stmts []batchStmt) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = w.db.execTx(stmts)
+		if err == nil || !retryable(err) || attempt > w.MaxRetries {
+			return
+		}
+		time.Sleep(crawler.Backoff(attempt, w.MinBackoff, w.MaxBackoff))
+	}
+}
+
+// Runs statements written for MySQL in one transaction.
+func (db *DB) execTx(stmts []batchStmt) (err error) {
+	var tx *sql.Tx
+	if tx, err = db.conn.Begin(); err != nil {
+		return
+	}
+	for _, s := range stmts {
+		if _, err = tx.Exec(db.dialect.translate(s.sql), s.args...); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	err = tx.Commit()
+	return
+}
+
+// Returns an INSERT statement with its VALUES tuple repeated n times, so
+// that it inserts n rows.
+func repeatValues(stmt string, n int) string {
+	i := strings.Index(stmt, "VALUES (") + len("VALUES ")
+	j := strings.Index(stmt, "ON DUPLICATE KEY UPDATE")
+	tuples := make([]string, n)
+	for k := range tuples {
+		tuples[k] = strings.TrimSpace(stmt[i:j])
+	}
+	return stmt[:i] + strings.Join(tuples, ",\n    ") + "\n    " + stmt[j:]
+}
+
+// Substrings of the messages of errors after which a transaction is worth
+// retrying: deadlocks, lock timeouts and lost connections.
+var retryableMessages = []string{
+	"#1205",                      // MySQL: lock wait timeout exceeded
+	"#1213",                      // MySQL: deadlock found
+	"#2006",                      // MySQL: server has gone away
+	"#2013",                      // MySQL: lost connection during query
+	"deadlock detected",          // PostgreSQL
+	"could not serialize access", // PostgreSQL
+	"database is locked",         // SQLite
+	"broken pipe",
+	"connection reset",
+	"connection refused",
+}
+
+// Reports whether a transaction that failed with err is worth retrying.
+func retryable(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	for _, s := range retryableMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
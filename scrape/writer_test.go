@@ -0,0 +1,214 @@
+package scrape
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriterSQLite(t *testing.T) {
+	db := openTestDatabase(t)
+	db.History = true
+	// Reject one deal, to check that the rest of its batch is stored.
+	_, err := db.conn.Exec(`
+	    CREATE TRIGGER reject BEFORE INSERT ON deal_daily_snapshot
+	    WHEN NEW.deal_id = 13
+	    BEGIN SELECT RAISE(ABORT, 'rejected'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := db.NewWriter(7, time.Hour)
+	var (
+		mu     sync.Mutex
+		failed []*WriteError
+	)
+	w.Failed = func(e *WriteError) {
+		mu.Lock()
+		failed = append(failed, e)
+		mu.Unlock()
+	}
+	var wg sync.WaitGroup
+	for _, site := range []string{"tmon", "wmp"} {
+		wg.Add(1)
+		go func(site string) {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				id := DealID(i % 20)
+				w.StoreDeal(&Deal{SiteName: site, DealID: id, NumSold: intp(i)})
+				w.StoreOption(&Option{SiteName: site, DealID: id, OptionID: 1, NumSold: i})
+			}
+		}(site)
+	}
+	wg.Wait()
+	w.Close()
+
+	if len(failed) != 2 {
+		t.Errorf("got %d failed rows, want 2: %v", len(failed), failed)
+	}
+	for _, e := range failed {
+		if e.Deal == nil || e.Deal.DealID != 13 || !strings.Contains(e.Error(), "rejected") {
+			t.Errorf("unexpected failure: %s", e)
+		}
+	}
+
+	today := today()
+	deals, err := db.GetDealDailySnapshots(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 38 {
+		t.Errorf("got %d deal snapshots, want 38", len(deals))
+	}
+	for _, r := range deals {
+		// Deals 0-9 were written twice; the second time counts.
+		want := int(r.DealID)
+		if want < 10 {
+			want += 20
+		}
+		if *r.NumSold != want {
+			t.Errorf("%s deal %d: %d sold, want %d", r.Site, r.DealID, *r.NumSold, want)
+		}
+	}
+	options, err := db.GetOptionDailySnapshots(today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options) != 40 {
+		t.Errorf("got %d option snapshots, want 40", len(options))
+	}
+
+	history, err := db.GetOptionSnapshots(DayTimes(today))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) == 0 {
+		t.Error("no option observations in the history")
+	}
+}
+
+func TestWriterAfterStored(t *testing.T) {
+	db := openTestDatabase(t)
+	w := db.NewWriter(10, time.Hour)
+	defer w.Close()
+	stored := make(chan int, 1)
+	w.StoreDeal(&Deal{SiteName: "tmon", DealID: 1})
+	w.AfterStored(func() {
+		r, err := db.GetDealDailySnapshot("tmon", 1, today())
+		if err != nil || r == nil {
+			t.Errorf("deal not stored before the callback: %v, %v", r, err)
+		}
+		stored <- 1
+	})
+	select {
+	case <-stored:
+		t.Fatal("callback called before the flush")
+	default:
+	}
+	w.Flush()
+	select {
+	case <-stored:
+	default:
+		t.Fatal("callback not called by the flush")
+	}
+}
+
+func TestWriterRetriesExhausted(t *testing.T) {
+	db := openTestDatabase(t)
+	// Fail every batch with deal 3 in it as if the database were locked.
+	_, err := db.conn.Exec(`
+	    CREATE TRIGGER locked BEFORE INSERT ON deal_daily_snapshot
+	    WHEN NEW.deal_id = 3
+	    BEGIN SELECT RAISE(ABORT, 'database is locked'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := db.NewWriter(5, time.Hour)
+	w.MaxRetries = 1
+	w.MinBackoff, w.MaxBackoff = 0, 0
+	var failed []*WriteError
+	w.Failed = func(e *WriteError) { failed = append(failed, e) }
+	for i := 0; i < 5; i++ {
+		w.StoreDeal(&Deal{SiteName: "tmon", DealID: DealID(i)})
+	}
+	w.Close()
+
+	// The whole batch fails together instead of being split up.
+	if len(failed) != 5 {
+		t.Errorf("got %d failed rows, want 5: %v", len(failed), failed)
+	}
+	deals, err := db.GetDealDailySnapshots(today())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 0 {
+		t.Errorf("got %d stored deals, want 0", len(deals))
+	}
+}
+
+func TestWriterDoesNotBlockOnRetries(t *testing.T) {
+	db := openTestDatabase(t)
+	_, err := db.conn.Exec(`
+	    CREATE TRIGGER locked BEFORE INSERT ON deal_daily_snapshot
+	    WHEN NEW.deal_id = 1
+	    BEGIN SELECT RAISE(ABORT, 'database is locked'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deal 1 fills a batch that is retried after a second or two; the next
+	// batches must be queued without waiting for it.
+	w := db.NewWriter(1, time.Hour)
+	w.MaxRetries = 1
+	w.MinBackoff, w.MaxBackoff = 2*time.Second, 2*time.Second
+	var failed []*WriteError
+	w.Failed = func(e *WriteError) { failed = append(failed, e) }
+	start := time.Now()
+	for i := 1; i < maxQueuedBatches; i++ {
+		w.StoreDeal(&Deal{SiteName: "tmon", DealID: DealID(i)})
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("storing took %s while a batch was being retried", d)
+	}
+	w.Close()
+	if len(failed) != 1 || failed[0].Deal.DealID != 1 {
+		t.Errorf("got failed rows %v, want deal 1", failed)
+	}
+}
+
+func TestRepeatValues(t *testing.T) {
+	got := repeatValues("INSERT INTO t (a, b) VALUES (?, NOW()) /* b */ ON DUPLICATE KEY UPDATE a = VALUES(a)", 2)
+	want := "INSERT INTO t (a, b) VALUES (?, NOW()) /* b */,\n    (?, NOW()) /* b */\n    ON DUPLICATE KEY UPDATE a = VALUES(a)"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("exec: %w", driver.ErrBadConn), true},
+		{errors.New(`Received #1213 error from MySQL server: "Deadlock found when trying to get lock"`), true},
+		{errors.New("pq: deadlock detected"), true},
+		{errors.New("database is locked"), true},
+		{errors.New(`Received #1406 error from MySQL server: "Data too long for column"`), false},
+		{errors.New("rejected"), false},
+	} {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// Returns the day today's snapshots are stored under.
+func today() time.Time {
+	return Day(time.Now())
+}